@@ -0,0 +1,126 @@
+package moleman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Budget tracks run-wide consumption against the limits block. A zero limit
+// means unlimited.
+type Budget struct {
+	Timeout             time.Duration
+	MaxAgentInvocations int
+	MaxTotalIterations  int
+	MaxCostUSD          float64
+
+	Started          time.Time
+	AgentInvocations int
+	TotalIterations  int
+	Usage            Usage
+}
+
+func newBudget(limits LimitsSpec, started time.Time) (*Budget, error) {
+	budget := &Budget{
+		MaxAgentInvocations: limits.MaxAgentInvocations,
+		MaxTotalIterations:  limits.MaxTotalIterations,
+		MaxCostUSD:          limits.MaxCostUSD,
+		Started:             started,
+	}
+	if limits.Timeout != "" {
+		parsed, err := time.ParseDuration(limits.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("limits timeout: %w", err)
+		}
+		budget.Timeout = parsed
+	}
+	return budget, nil
+}
+
+// uncostedAgents lists the agents the workflow uses whose output carries no
+// cost (everything but Claude), so maxCostUSD cannot limit them.
+func uncostedAgents(cfg *Config) []string {
+	names := []string{}
+	for _, item := range flattenAgentNodes(cfg.Workflow) {
+		if cfg.Agents[item.Agent].Type == "claude" || isOneOf(item.Agent, names) {
+			continue
+		}
+		names = append(names, item.Agent)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (b *Budget) startAgent(nodeName string) error {
+	if b.MaxAgentInvocations > 0 && b.AgentInvocations >= b.MaxAgentInvocations {
+		return fmt.Errorf("%w: maxAgentInvocations (%d) reached before node %s", ErrBudgetExceeded, b.MaxAgentInvocations, nodeName)
+	}
+	b.AgentInvocations++
+	return nil
+}
+
+func (b *Budget) startIteration() error {
+	if b.MaxTotalIterations > 0 && b.TotalIterations >= b.MaxTotalIterations {
+		return fmt.Errorf("%w: maxTotalIterations (%d) reached", ErrBudgetExceeded, b.MaxTotalIterations)
+	}
+	b.TotalIterations++
+	return nil
+}
+
+func (b *Budget) addUsage(usage *Usage) {
+	b.Usage.Add(usage)
+}
+
+func (b *Budget) checkCost(nodeName string) error {
+	if b.MaxCostUSD > 0 && b.Usage.CostUSD >= b.MaxCostUSD {
+		return fmt.Errorf("%w: maxCostUSD ($%.2f) reached after node %s (spent $%.4f)", ErrBudgetExceeded, b.MaxCostUSD, nodeName, b.Usage.CostUSD)
+	}
+	return nil
+}
+
+func (b *Budget) TemplateData() map[string]any {
+	elapsed := time.Since(b.Started)
+	remaining := map[string]any{}
+	if b.Timeout > 0 {
+		left := b.Timeout - elapsed
+		if left < 0 {
+			left = 0
+		}
+		remaining["time"] = left.Round(time.Second).String()
+		remaining["seconds"] = int(left.Seconds())
+	}
+	if b.MaxAgentInvocations > 0 {
+		remaining["agentInvocations"] = b.MaxAgentInvocations - b.AgentInvocations
+	}
+	if b.MaxTotalIterations > 0 {
+		remaining["iterations"] = b.MaxTotalIterations - b.TotalIterations
+	}
+	if b.MaxCostUSD > 0 {
+		remaining["costUSD"] = b.MaxCostUSD - b.Usage.CostUSD
+	}
+	return map[string]any{
+		"elapsed":          elapsed.Round(time.Second).String(),
+		"agentInvocations": b.AgentInvocations,
+		"iterations":       b.TotalIterations,
+		"tokens":           b.Usage.TotalTokens,
+		"costUSD":          b.Usage.CostUSD,
+		"remaining":        remaining,
+	}
+}
+
+// stopErr reports why the run context is done: the workflow timeout expiring
+// is a budget error, anything else is a user cancellation.
+func (ctx *RunContext) stopErr() error {
+	switch ctx.Context.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return fmt.Errorf("%w: workflow timeout (%s) elapsed", ErrBudgetExceeded, ctx.Budget.Timeout)
+	default:
+		return ErrCancelled
+	}
+}
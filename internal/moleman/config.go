@@ -1,43 +1,121 @@
 package moleman
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/log"
 	"gopkg.in/yaml.v3"
 )
 
 func LoadConfig(path string) (*Config, error) {
+	return LoadConfigWithVars(path, nil)
+}
+
+// LoadConfigWithVars loads a config with param values from --var and
+// --vars-file applied over the declared defaults.
+func LoadConfigWithVars(path string, vars map[string]any) (*Config, error) {
+	return LoadConfigWithOptions(path, LoadOptions{Vars: vars})
+}
+
+// LoadConfigWithOptions loads a config with param values and a profile.
+func LoadConfigWithOptions(path string, opts LoadOptions) (*Config, error) {
 	raw, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read config: %w", err)
 	}
 
-	cfg := &Config{}
-	if err := yaml.Unmarshal(raw, cfg); err != nil {
-		return nil, fmt.Errorf("parse yaml: %w", err)
+	doc, err := parseYAML(path, raw)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := paramSpecs(path, doc)
+	if err != nil {
+		return nil, err
 	}
-	baseAgents, err := loadBaseAgents(path)
+	profile, err := selectProfile(path, doc, opts.Profile)
 	if err != nil {
 		return nil, err
 	}
-	if cfg.Version != 1 {
-		return nil, fmt.Errorf("unsupported config version: %d", cfg.Version)
+	params, err := resolveParams(specs, profileVars(profile, opts.Vars))
+	if err != nil {
+		return nil, locateConfigError(err, path, doc)
+	}
+	version := configVersion(doc)
+	rewritten, err := bindWorkflowParams(path, doc, params, version)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if version == 2 {
+		if err := checkStrictYAML(path, raw, doc, &ConfigV2{}, rewritten); err != nil {
+			return nil, err
+		}
+		v2 := &ConfigV2{}
+		if err := doc.Decode(v2); err != nil {
+			return nil, fmt.Errorf("%s: parse yaml: %w", path, err)
+		}
+		if err := v2.validateStepKinds(); err != nil {
+			return nil, locateConfigError(err, path, doc)
+		}
+		cfg = v2.toConfig()
+	} else {
+		if err := checkStrictYAML(path, raw, doc, &Config{}, rewritten); err != nil {
+			return nil, err
+		}
+		if len(doc.Content) > 0 {
+			if err := doc.Decode(cfg); err != nil {
+				return nil, fmt.Errorf("%s: parse yaml: %w", path, err)
+			}
+		}
+	}
+	cfg.paramValues = params
+	cfg.profile = opts.Profile
+	if err := selectWorkflow(cfg, opts.Workflow); err != nil {
+		return nil, err
+	}
+	applyProfileLoops(cfg.Workflow, profile.Loops)
+	if cfg.Version != 1 && cfg.Version != 2 {
+		return nil, locateConfigError(configErrorf("version", "%d is not supported", cfg.Version), path, doc)
 	}
 	if cfg.Agents == nil {
 		cfg.Agents = map[string]AgentConfig{}
 	}
-	mergedAgents, err := mergeAgents(baseAgents, cfg.Agents)
+	cfg.configAgents = cfg.Agents
+	layers, err := loadAgentLayers(path, opts.Workdir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Profile != "" {
+		layer, err := profileLayer(opts.Profile, profile, layers)
+		if err != nil {
+			return nil, locateConfigError(err, path, doc)
+		}
+		layers = append(layers, layer)
+	}
+	used := map[string]bool{}
+	for _, set := range workflowSets(cfg) {
+		for _, item := range flattenAgentNodes(set.items) {
+			used[item.Agent] = true
+		}
+	}
+	mergedAgents, sources, err := mergeAgents(layers, used)
 	if err != nil {
 		return nil, err
 	}
 	cfg.Agents = mergedAgents
+	cfg.agentSources = sources
 	if err := ValidateConfig(cfg); err != nil {
-		return nil, err
+		if cfg.Version == 2 {
+			err = toV2ConfigError(err)
+		}
+		err = toProfileConfigError(err, cfg)
+		return nil, locateConfigError(err, path, doc)
 	}
 	return cfg, nil
 }
@@ -59,85 +137,272 @@ func ConfigDir(path string) string {
 	return dir
 }
 
-func PrintWorkflow(workflow []WorkflowItem) error {
-	raw, err := json.MarshalIndent(workflow, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal workflow: %w", err)
+// ValidateConfig checks a loaded config. Errors are *ConfigError values
+// naming the offending node path.
+func ValidateConfig(cfg *Config) error {
+	if len(cfg.Agents) == 0 {
+		return configErrorf("agents", "map is empty")
 	}
-	_, err = os.Stdout.Write(raw)
-	if err != nil {
-		return fmt.Errorf("write workflow: %w", err)
+	if len(cfg.Workflow) == 0 && len(cfg.Workflows) == 0 {
+		return configErrorf("workflow", "is empty")
+	}
+	for _, name := range AgentNames(cfg) {
+		if err := validateAgent(name, cfg.Agents[name]); err != nil {
+			return err
+		}
+	}
+	if err := validateLimits(cfg.Limits); err != nil {
+		return err
+	}
+	if _, err := newRedactor(cfg.Redact); err != nil {
+		return err
+	}
+	if err := validateProfiles(cfg); err != nil {
+		return err
+	}
+	if err := validateWorkflowSets(cfg); err != nil {
+		return err
 	}
-	_, _ = os.Stdout.Write([]byte("\n"))
 	return nil
 }
 
-func ValidateConfig(cfg *Config) error {
-	if len(cfg.Agents) == 0 {
-		return fmt.Errorf("agents map is empty")
+// validateAgent checks one resolved agent.
+func validateAgent(name string, agent AgentConfig) error {
+	path := "agents." + name
+	if agent.Type == "" {
+		return configErrorf(path, "missing type")
+	}
+	if !isOneOf(agent.Type, agentTypes) {
+		return configErrorf(path+".type", "is not supported: %s", agent.Type)
 	}
-	if len(cfg.Workflow) == 0 {
-		return fmt.Errorf("workflow is empty")
+	if agent.Type == "generic" && agent.Command == "" {
+		return configErrorf(path, "type generic requires command")
 	}
-	for name, agent := range cfg.Agents {
-		if agent.Type == "" {
-			return fmt.Errorf("agent %s missing type", name)
+	if agent.Type == "replay" && agent.Run == "" {
+		return configErrorf(path, "type replay requires run")
+	}
+	if agent.Run != "" && agent.Type != "replay" {
+		return configErrorf(path+".run", "is only supported for replay")
+	}
+	if agent.Model != "" && (agent.Type == "generic" || agent.Type == "replay") {
+		return configErrorf(path+".model", "is only supported for codex or claude")
+	}
+	if agent.Thinking != "" && agent.Type != "codex" {
+		return configErrorf(path+".thinking", "is only supported for codex")
+	}
+	if agent.Thinking != "" && !isOneOf(agent.Thinking, codexThinkingLevels) {
+		return configErrorf(path+".thinking", "must be one of %s", strings.Join(codexThinkingLevels, ", "))
+	}
+	for _, stream := range agent.Capture {
+		if !isOneOf(stream, captureStreams) {
+			return configErrorf(path+".capture", "must only contain %s", strings.Join(captureStreams, ", "))
 		}
-		switch agent.Type {
-		case "codex", "claude", "generic":
-		default:
-			return fmt.Errorf("agent %s has unsupported type: %s", name, agent.Type)
+	}
+	for _, stream := range agent.Print {
+		if !isOneOf(stream, printStreams) {
+			return configErrorf(path+".print", "must only contain %s", strings.Join(printStreams, ", "))
 		}
-		if agent.Type == "generic" && agent.Command == "" {
-			return fmt.Errorf("agent %s type generic requires command", name)
+	}
+	envKeys := make([]string, 0, len(agent.Env))
+	for key := range agent.Env {
+		envKeys = append(envKeys, key)
+	}
+	sort.Strings(envKeys)
+	for _, key := range envKeys {
+		if agent.Env[key].Value != "" && agent.Env[key].FromFile != "" {
+			return configErrorf(path+".env."+key, "sets both value and fromFile")
 		}
-		if agent.Model != "" && agent.Type == "generic" {
-			return fmt.Errorf("agent %s model is only supported for codex or claude", name)
+	}
+	if agent.Session != nil {
+		if err := validateSession(*agent.Session, path+".session"); err != nil {
+			return err
 		}
-		if agent.Thinking != "" && agent.Type != "codex" {
-			return fmt.Errorf("agent %s thinking is only supported for codex", name)
+	}
+	return nil
+}
+
+func validateLimits(limits LimitsSpec) error {
+	if limits.Timeout != "" {
+		parsed, err := time.ParseDuration(limits.Timeout)
+		if err != nil {
+			return configErrorf("limits.timeout", "is invalid: %v", err)
 		}
-		if agent.Thinking != "" && !isValidCodexThinking(agent.Thinking) {
-			return fmt.Errorf("agent %s thinking must be one of minimal, low, medium, high, xhigh", name)
+		if parsed <= 0 {
+			return configErrorf("limits.timeout", "must be > 0")
 		}
 	}
-	seenNames := map[string]bool{}
-	if err := validateWorkflow(cfg, cfg.Workflow, seenNames); err != nil {
-		return err
+	if limits.MaxAgentInvocations < 0 {
+		return configErrorf("limits.maxAgentInvocations", "must be >= 0")
+	}
+	if limits.MaxTotalIterations < 0 {
+		return configErrorf("limits.maxTotalIterations", "must be >= 0")
+	}
+	if limits.MaxCostUSD < 0 {
+		return configErrorf("limits.maxCostUSD", "must be >= 0")
 	}
 	return nil
 }
 
-func isValidCodexThinking(value string) bool {
-	switch value {
-	case "minimal", "low", "medium", "high", "xhigh":
-		return true
-	default:
-		return false
-	}
+// agentLayer is one source of agent definitions. Later layers override
+// earlier ones: built-in defaults, ~/.moleman/agents.yaml, agents.yaml at the
+// repo root, agents.yaml next to the config (or its agentsFile), then the
+// config's own agents. Agents of an implicit layer are only resolved when
+// something references them. Problems with agents of a lenient layer that no
+// workflow needs are warnings, so one bad entry in the user-level file does
+// not break every repo.
+type agentLayer struct {
+	label    string
+	agents   map[string]AgentConfig
+	implicit bool
+	lenient  bool
+	// problems holds per-agent parse errors of a lenient layer.
+	problems map[string]error
+}
+
+// builtinAgents are used for codex and claude when no agents file defines
+// them.
+var builtinAgents = map[string]AgentConfig{
+	"codex": {
+		Type:    "codex",
+		Args:    []string{"--full-auto"},
+		Timeout: "45m",
+		Capture: []string{"stdout", "stderr", "exitCode"},
+	},
+	"claude": {
+		Type:    "claude",
+		Timeout: "30m",
+		Capture: []string{"stdout", "stderr", "exitCode"},
+	},
 }
 
-func loadBaseAgents(configPath string) (map[string]AgentConfig, error) {
+func loadAgentLayers(configPath, workdir string, cfg *Config) ([]agentLayer, error) {
+	layers := []agentLayer{{label: "built-in", agents: builtinAgents, implicit: true}}
+	if userPath := userAgentsPath(); userPath != "" {
+		agents, problems, err := readUserAgentsFile(userPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			layers = append(layers, agentLayer{label: "~/.moleman/agents.yaml", agents: agents, lenient: true, problems: problems})
+		}
+	}
+
 	dir := ConfigDir(configPath)
 	if dir == "" {
 		dir = "."
 	}
-	agentsPath := filepath.Join(dir, "agents.yaml")
-	if _, err := os.Stat(agentsPath); err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("agents.yaml not found: %s", agentsPath)
+	localPath := filepath.Join(dir, "agents.yaml")
+	if workdir == "" {
+		workdir = dir
+	}
+	if root := findRepoRoot(workdir); root != "" {
+		rootPath := filepath.Join(root, "agents.yaml")
+		if !sameFile(rootPath, localPath) {
+			agents, err := readAgentsFile(rootPath)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			if err == nil {
+				layers = append(layers, agentLayer{label: agentsFileLabel(dir, rootPath), agents: agents})
+			}
 		}
-		return nil, fmt.Errorf("stat agents.yaml: %w", err)
 	}
-	raw, err := os.ReadFile(agentsPath)
+
+	if cfg.AgentsFile != "" {
+		path := cfg.AgentsFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		agents, err := readAgentsFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("agentsFile not found: %s", path)
+			}
+			return nil, err
+		}
+		layers = append(layers, agentLayer{label: cfg.AgentsFile, agents: agents})
+	} else {
+		agents, err := readAgentsFile(localPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			layers = append(layers, agentLayer{label: "agents.yaml", agents: agents})
+		}
+	}
+	layers = append(layers, agentLayer{label: filepath.Base(configPath), agents: cfg.Agents})
+	return layers, nil
+}
+
+func userAgentsPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".moleman", "agents.yaml")
+}
+
+// findRepoRoot returns the nearest directory at or above dir containing
+// .git, or "" outside a repository.
+func findRepoRoot(dir string) string {
+	current, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return ""
+		}
+		current = parent
+	}
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// agentsFileLabel names an agents file relative to the config dir when it
+// sits in the config dir or one of its parents, and by absolute path
+// otherwise.
+func agentsFileLabel(configDir, path string) string {
+	absDir, errDir := filepath.Abs(configDir)
+	absPath, errPath := filepath.Abs(path)
+	if errDir != nil || errPath != nil {
+		return path
+	}
+	rel, err := filepath.Rel(absDir, absPath)
 	if err != nil {
-		return nil, fmt.Errorf("read agents.yaml: %w", err)
+		return absPath
+	}
+	for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if part != ".." && part != "." {
+			return absPath
+		}
+	}
+	return rel
+}
+
+// readAgentsFile reads the agents map of an agents file. A missing file is
+// returned as is so callers can check os.IsNotExist.
+func readAgentsFile(path string) (map[string]AgentConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("read %s: %w", path, err)
 	}
 	var payload struct {
 		Agents map[string]AgentConfig `yaml:"agents"`
 	}
-	if err := yaml.Unmarshal(raw, &payload); err != nil {
-		return nil, fmt.Errorf("parse agents.yaml: %w", err)
+	if _, err := decodeStrictYAML(path, raw, &payload); err != nil {
+		return nil, err
 	}
 	if payload.Agents == nil {
 		payload.Agents = map[string]AgentConfig{}
@@ -145,25 +410,229 @@ func loadBaseAgents(configPath string) (map[string]AgentConfig, error) {
 	return payload.Agents, nil
 }
 
-func mergeAgents(base, overrides map[string]AgentConfig) (map[string]AgentConfig, error) {
+// readUserAgentsFile reads an agents file like readAgentsFile, but returns
+// errors that belong to a single agent per agent name instead of failing.
+func readUserAgentsFile(path string) (map[string]AgentConfig, map[string]error, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	doc, err := parseYAML(path, raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	var payload struct {
+		Agents map[string]AgentConfig `yaml:"agents"`
+	}
+	strictErr := checkStrictYAML(path, raw, doc, &payload, nil)
+	if strictErr == nil {
+		if payload.Agents == nil {
+			payload.Agents = map[string]AgentConfig{}
+		}
+		return payload.Agents, nil, nil
+	}
+	// Decode what can be decoded and attach each error to its agent.
+	payload.Agents = nil
+	var typeErr *yaml.TypeError
+	if err := doc.Decode(&payload); err != nil && !errors.As(err, &typeErr) {
+		return nil, nil, fmt.Errorf("%s: parse yaml: %w", path, err)
+	}
+	errs := []error{strictErr}
+	if joined, ok := strictErr.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	problems := map[string]error{}
+	for _, err := range errs {
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) || !strings.HasPrefix(configErr.Path, "agents.") {
+			return nil, nil, strictErr
+		}
+		name := strings.SplitN(strings.TrimPrefix(configErr.Path, "agents."), ".", 2)[0]
+		if _, seen := problems[name]; !seen {
+			problems[name] = err
+		}
+	}
+	if payload.Agents == nil {
+		payload.Agents = map[string]AgentConfig{}
+	}
+	for name := range problems {
+		if _, ok := payload.Agents[name]; !ok {
+			payload.Agents[name] = AgentConfig{}
+		}
+	}
+	return payload.Agents, problems, nil
+}
+
+// mergeAgents resolves every agent across layers, plus agents of implicit
+// layers named in used. An agent is merged over the agent it extends, or
+// without extends over the same name in a lower layer. extends sees agents
+// in the same or lower layers and may chain to any depth. It also returns,
+// per agent, which layer each set field came from (see agentFieldSources).
+func mergeAgents(layers []agentLayer, used map[string]bool) (map[string]AgentConfig, map[string]map[string]string, error) {
+	resolver := &agentResolver{layers: layers, done: map[agentKey]resolvedAgent{}, visiting: map[agentKey]bool{}}
 	merged := map[string]AgentConfig{}
-	for name, agent := range base {
-		merged[name] = agent
-	}
-	for name, agent := range overrides {
-		baseAgent := AgentConfig{}
-		if agent.Extends != "" {
-			extended, ok := base[agent.Extends]
-			if !ok {
-				return nil, fmt.Errorf("agent %s extends unknown agent: %s", name, agent.Extends)
+	sources := map[string]map[string]string{}
+	// Agents of lenient layers are resolved last, so those an extends chain
+	// of a needed agent pulled in are known to be needed too.
+	deferred := []agentKey{}
+	for layer := len(layers) - 1; layer >= 0; layer-- {
+		for _, name := range sortedKeys(layers[layer].agents) {
+			if _, ok := merged[name]; ok {
+				continue
+			}
+			if layers[layer].implicit && !used[name] {
+				continue
+			}
+			if layers[layer].lenient && !used[name] {
+				merged[name] = AgentConfig{}
+				deferred = append(deferred, agentKey{layer: layer, name: name})
+				continue
 			}
-			baseAgent = extended
-		} else if existing, ok := merged[name]; ok {
-			baseAgent = existing
+			resolved, err := resolver.resolve(layer, name)
+			if err != nil {
+				return nil, nil, err
+			}
+			merged[name] = resolved.agent
+			sources[name] = resolved.sources
+		}
+	}
+	needed := map[agentKey]bool{}
+	for key := range resolver.done {
+		needed[key] = true
+	}
+	for _, key := range deferred {
+		resolved, err := resolver.resolve(key.layer, key.name)
+		if err == nil && !needed[key] {
+			err = validateAgent(key.name, resolved.agent)
+		}
+		if err != nil && !needed[key] {
+			log.Warn("ignoring unused agent", "file", layers[key.layer].label, "agent", key.name, "err", err)
+			delete(merged, key.name)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		merged[key.name] = resolved.agent
+		sources[key.name] = resolved.sources
+	}
+	return merged, sources, nil
+}
+
+type agentKey struct {
+	layer int
+	name  string
+}
+
+type resolvedAgent struct {
+	agent   AgentConfig
+	sources map[string]string
+}
+
+type agentResolver struct {
+	layers   []agentLayer
+	done     map[agentKey]resolvedAgent
+	visiting map[agentKey]bool
+	chain    []string
+}
+
+func (r *agentResolver) resolve(layer int, name string) (resolvedAgent, error) {
+	key := agentKey{layer: layer, name: name}
+	if resolved, ok := r.done[key]; ok {
+		return resolved, nil
+	}
+	if r.visiting[key] {
+		return resolvedAgent{}, fmt.Errorf("agent extends cycle: %s -> %s", strings.Join(r.chain, " -> "), name)
+	}
+	r.visiting[key] = true
+	r.chain = append(r.chain, name)
+	defer func() {
+		delete(r.visiting, key)
+		r.chain = r.chain[:len(r.chain)-1]
+	}()
+
+	if err := r.layers[layer].problems[name]; err != nil {
+		return resolvedAgent{}, err
+	}
+	raw := r.layers[layer].agents[name]
+	parent := resolvedAgent{sources: map[string]string{}}
+	parentName := name
+	if raw.Extends != "" {
+		parentName = raw.Extends
+	}
+	if parentLayer, ok := r.find(parentName, layer, key); ok {
+		resolved, err := r.resolve(parentLayer, parentName)
+		if err != nil {
+			return resolvedAgent{}, err
+		}
+		parent = resolved
+	} else if raw.Extends != "" {
+		return resolvedAgent{}, fmt.Errorf("agent %s extends unknown agent: %s", name, raw.Extends)
+	}
+
+	sources := map[string]string{}
+	for field, source := range parent.sources {
+		if parentName != name && !strings.HasSuffix(source, ")") {
+			source = fmt.Sprintf("%s (%s)", source, parentName)
+		}
+		sources[field] = source
+	}
+	for field, source := range agentFieldSources(raw, r.layers[layer].label) {
+		sources[field] = source
+	}
+	for _, key := range raw.EnvUnset {
+		delete(sources, "env."+key)
+	}
+	resolved := resolvedAgent{agent: mergeAgentConfig(parent.agent, raw), sources: sources}
+	r.done[key] = resolved
+	return resolved, nil
+}
+
+// find returns the highest layer at or below maxLayer defining name, other
+// than the agent being resolved.
+func (r *agentResolver) find(name string, maxLayer int, self agentKey) (int, bool) {
+	for layer := maxLayer; layer >= 0; layer-- {
+		if (agentKey{layer: layer, name: name}) == self {
+			continue
+		}
+		if _, ok := r.layers[layer].agents[name]; ok {
+			return layer, true
 		}
-		merged[name] = mergeAgentConfig(baseAgent, agent)
 	}
-	return merged, nil
+	return 0, false
+}
+
+// agentFieldSources maps each field set on agent (env per key, as env.KEY)
+// to source.
+func agentFieldSources(agent AgentConfig, source string) map[string]string {
+	set := map[string]bool{
+		"type":         agent.Type != "",
+		"command":      agent.Command != "",
+		"run":          agent.Run != "",
+		"model":        agent.Model != "",
+		"thinking":     agent.Thinking != "",
+		"args":         agent.Args != nil,
+		"argsAppend":   agent.ArgsAppend != nil,
+		"outputSchema": agent.OutputSchema != "",
+		"outputFile":   agent.OutputFile != "",
+		"timeout":      agent.Timeout != "",
+		"capture":      agent.Capture != nil,
+		"print":        agent.Print != nil,
+		"session":      agent.Session != nil,
+	}
+	fields := map[string]string{}
+	for field, ok := range set {
+		if ok {
+			fields[field] = source
+		}
+	}
+	for key := range agent.Env {
+		fields["env."+key] = source
+	}
+	return fields
 }
 
 func mergeAgentConfig(base, override AgentConfig) AgentConfig {
@@ -174,6 +643,9 @@ func mergeAgentConfig(base, override AgentConfig) AgentConfig {
 	if override.Command != "" {
 		result.Command = override.Command
 	}
+	if override.Run != "" {
+		result.Run = override.Run
+	}
 	if override.Model != "" {
 		result.Model = override.Model
 	}
@@ -183,19 +655,27 @@ func mergeAgentConfig(base, override AgentConfig) AgentConfig {
 	if override.Args != nil {
 		result.Args = override.Args
 	}
+	if override.ArgsAppend != nil {
+		result.Args = append(append([]string{}, result.Args...), override.ArgsAppend...)
+	}
 	if override.OutputSchema != "" {
 		result.OutputSchema = override.OutputSchema
 	}
 	if override.OutputFile != "" {
 		result.OutputFile = override.OutputFile
 	}
-	if override.Env != nil {
-		if result.Env == nil {
-			result.Env = map[string]string{}
+	if override.Env != nil || override.EnvUnset != nil {
+		env := map[string]EnvValue{}
+		for key, value := range base.Env {
+			env[key] = value
 		}
 		for key, value := range override.Env {
-			result.Env[key] = value
+			env[key] = value
+		}
+		for _, key := range override.EnvUnset {
+			delete(env, key)
 		}
+		result.Env = env
 	}
 	if override.Timeout != "" {
 		result.Timeout = override.Timeout
@@ -210,53 +690,66 @@ func mergeAgentConfig(base, override AgentConfig) AgentConfig {
 		result.Session = override.Session
 	}
 	result.Extends = ""
+	result.ArgsAppend = nil
+	result.EnvUnset = nil
 	return result
 }
 
-func validateWorkflow(cfg *Config, items []WorkflowItem, seenNames map[string]bool) error {
+func validateWorkflow(cfg *Config, items []WorkflowItem, location []int, seenNames map[string]bool) error {
 	for idx, item := range items {
+		itemLocation := append(append([]int(nil), location...), idx)
+		path := workflowPath(itemLocation)
 		switch item.Type {
 		case "agent":
 			if item.Agent == "" {
-				return fmt.Errorf("workflow[%d] agent is required", idx)
+				return configErrorf(path, "agent is required")
 			}
 			if _, ok := cfg.Agents[item.Agent]; !ok {
-				return fmt.Errorf("workflow[%d] references unknown agent: %s", idx, item.Agent)
+				return configErrorf(path+".agent", "references unknown agent: %s", item.Agent)
 			}
 			if item.Name == "" {
-				return fmt.Errorf("workflow[%d] name is required", idx)
+				return configErrorf(path, "name is required")
 			}
 			if seenNames[item.Name] {
-				return fmt.Errorf("duplicate workflow name: %s", item.Name)
+				return configErrorf(path+".name", "duplicates workflow name: %s", item.Name)
 			}
 			seenNames[item.Name] = true
-			if err := validateInput(item.Input, idx); err != nil {
+			if err := validateInput(item.Input, path+".input"); err != nil {
+				return err
+			}
+			if err := validateOutput(item.Output, path+".output", cfg.Version); err != nil {
 				return err
 			}
-			if err := validateOutput(item.Output, idx); err != nil {
+			if err := validateSession(item.Session, path+".session"); err != nil {
 				return err
 			}
 		case "loop":
+			if item.Name != "" {
+				if seenNames[item.Name] {
+					return configErrorf(path+".name", "duplicates workflow name: %s", item.Name)
+				}
+				seenNames[item.Name] = true
+			}
 			if item.MaxIters <= 0 {
-				return fmt.Errorf("workflow[%d] loop maxIters must be > 0", idx)
+				return configErrorf(path, "loop maxIters must be > 0")
 			}
 			if strings.TrimSpace(item.Until) == "" {
-				return fmt.Errorf("workflow[%d] loop until is required", idx)
+				return configErrorf(path, "loop until is required")
 			}
 			if len(item.Body) == 0 {
-				return fmt.Errorf("workflow[%d] loop body is empty", idx)
+				return configErrorf(path, "loop body is empty")
 			}
-			if err := validateWorkflow(cfg, item.Body, seenNames); err != nil {
+			if err := validateWorkflow(cfg, item.Body, itemLocation, seenNames); err != nil {
 				return err
 			}
 		default:
-			return fmt.Errorf("workflow[%d] unknown type: %s", idx, item.Type)
+			return configErrorf(path+".type", "is unknown: %s (want %s)", item.Type, strings.Join(workflowItemTypes, " or "))
 		}
 	}
 	return nil
 }
 
-func validateInput(input InputSpec, idx int) error {
+func validateInput(input InputSpec, path string) error {
 	count := 0
 	if input.Prompt != "" {
 		count++
@@ -268,15 +761,17 @@ func validateInput(input InputSpec, idx int) error {
 		count++
 	}
 	if count == 0 {
-		return fmt.Errorf("workflow[%d] input requires one of prompt, file, or from", idx)
+		return configErrorf(path, "requires one of %s", joinOr(inputSources))
 	}
 	if count > 1 {
-		return fmt.Errorf("workflow[%d] input must specify only one of prompt, file, or from", idx)
+		return configErrorf(path, "must specify only one of %s", joinOr(inputSources))
 	}
 	return nil
 }
 
-func validateOutput(output OutputSpec, idx int) error {
+// validateOutput checks an output has a target; version 1 configs allow
+// exactly one.
+func validateOutput(output OutputSpec, path string, version int) error {
 	count := 0
 	if output.ToNext {
 		count++
@@ -288,10 +783,20 @@ func validateOutput(output OutputSpec, idx int) error {
 		count++
 	}
 	if count == 0 {
-		return fmt.Errorf("workflow[%d] output requires one of toNext, file, or stdout", idx)
+		return configErrorf(path, "requires one of %s", joinOr(outputTargets))
 	}
-	if count > 1 {
-		return fmt.Errorf("workflow[%d] output must specify only one of toNext, file, or stdout", idx)
+	if count > 1 && version < 2 {
+		return configErrorf(path, "must specify only one of %s", joinOr(outputTargets))
+	}
+	if output.Type != "" && !isOneOf(output.Type, outputTypes) {
+		return configErrorf(path+".type", "must be one of %s", strings.Join(outputTypes, ", "))
+	}
+	return nil
+}
+
+func validateSession(session SessionSpec, path string) error {
+	if session.Resume != "" && !isOneOf(session.Resume, sessionResumeModes) {
+		return configErrorf(path+".resume", "must be one of %s", strings.Join(sessionResumeModes, ", "))
 	}
 	return nil
 }
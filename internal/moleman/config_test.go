@@ -0,0 +1,399 @@
+package moleman
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigResolvesExtendsChainsAcrossLayers(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".moleman"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeFile(t, filepath.Join(home, ".moleman", "agents.yaml"), `agents:
+  claude:
+    type: claude
+    timeout: 45m
+    env:
+      SHARED: user
+      DROP: me
+`)
+	tempDir := t.TempDir()
+	writeFile(t, filepath.Join(tempDir, "agents.yaml"), `agents:
+  claude:
+    model: sonnet
+    args: ["--verbose"]
+`)
+	writeFile(t, filepath.Join(tempDir, "moleman.yaml"), `version: 1
+
+agents:
+  reviewer:
+    extends: claude
+    model: opus
+    argsAppend: ["--max-turns", "3"]
+    envUnset: [DROP]
+  strict-reviewer:
+    extends: reviewer
+    env:
+      MODE: strict
+
+workflow:
+  - type: agent
+    name: review
+    agent: strict-reviewer
+    input:
+      prompt: "review"
+    output:
+      toNext: true
+`)
+	cfg, err := LoadConfig(filepath.Join(tempDir, "moleman.yaml"))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	agent := cfg.Agents["strict-reviewer"]
+	if agent.Type != "claude" || agent.Model != "opus" || agent.Timeout != "45m" {
+		t.Fatalf("unexpected merged agent: %+v", agent)
+	}
+	if got := strings.Join(agent.Args, " "); got != "--verbose --max-turns 3" {
+		t.Fatalf("unexpected args: %q", got)
+	}
+	if _, ok := agent.Env["DROP"]; ok || agent.Env["SHARED"].Value != "user" || agent.Env["MODE"].Value != "strict" {
+		t.Fatalf("unexpected env: %v", agent.Env)
+	}
+	if base := cfg.Agents["claude"]; len(base.Args) != 1 || base.Env["DROP"].Value != "me" {
+		t.Fatalf("base agent was modified: %+v", base)
+	}
+
+	wantSources := map[string]string{
+		"type":       "~/.moleman/agents.yaml (claude)",
+		"model":      "moleman.yaml (reviewer)",
+		"args":       "agents.yaml (claude)",
+		"env.MODE":   "moleman.yaml",
+		"env.SHARED": "~/.moleman/agents.yaml (claude)",
+	}
+	sources := cfg.agentSources["strict-reviewer"]
+	for field, want := range wantSources {
+		if sources[field] != want {
+			t.Fatalf("source of %s: got %q, want %q", field, sources[field], want)
+		}
+	}
+	if _, ok := sources["env.DROP"]; ok {
+		t.Fatalf("expected unset env to have no source: %v", sources)
+	}
+}
+
+func TestLoadConfigRejectsExtendsCycle(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	writeFile(t, filepath.Join(tempDir, "agents.yaml"), "agents: {}\n")
+	writeFile(t, filepath.Join(tempDir, "moleman.yaml"), `version: 1
+
+agents:
+  a:
+    extends: b
+  b:
+    extends: a
+
+workflow:
+  - type: agent
+    name: review
+    agent: a
+    input:
+      prompt: "review"
+    output:
+      toNext: true
+`)
+	_, err := LoadConfig(filepath.Join(tempDir, "moleman.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "agent extends cycle") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+}
+
+func TestLoadConfigOnlyValidatesUsedUserAgents(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".moleman"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeFile(t, filepath.Join(home, ".moleman", "agents.yaml"), `agents:
+  broken:
+    type: codex
+    modle: o3
+  bad:
+    type: generic
+  orphan:
+    extends: missing
+  base:
+    type: generic
+    command: printf
+`)
+	tempDir := t.TempDir()
+	writeFile(t, filepath.Join(tempDir, "agents.yaml"), "agents: {}\n")
+	config := `version: 1
+
+agents:
+  coder:
+    extends: base
+
+workflow:
+  - type: agent
+    name: write
+    agent: %s
+    input:
+      prompt: "write"
+    output:
+      toNext: true
+`
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, fmt.Sprintf(config, "coder"))
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("expected unused user agents to be ignored, got %v", err)
+	}
+	if got := strings.Join(AgentNames(cfg), ","); got != "base,coder" {
+		t.Fatalf("unexpected agents: %s", got)
+	}
+
+	for agent, want := range map[string]string{
+		"broken": "agents.broken.modle is not a known field",
+		"bad":    "agents.bad type generic requires command",
+		"orphan": "agent orphan extends unknown agent: missing",
+	} {
+		writeFile(t, configPath, fmt.Sprintf(config, agent))
+		if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected %q, got %v", agent, want, err)
+		}
+	}
+}
+
+func TestLoadConfigLayersRepoAgentsAndBuiltins(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeFile(t, filepath.Join(repo, "agents.yaml"), `agents:
+  claude:
+    model: opus
+`)
+	configDir := filepath.Join(repo, "workflows")
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeFile(t, filepath.Join(configDir, "moleman.yaml"), `version: 1
+
+workflow:
+  - type: agent
+    name: write
+    agent: claude
+    input:
+      prompt: "write"
+    output:
+      toNext: true
+`)
+	cfg, err := LoadConfig(filepath.Join(configDir, "moleman.yaml"))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	agent := cfg.Agents["claude"]
+	if agent.Type != "claude" || agent.Model != "opus" || agent.Timeout != "30m" {
+		t.Fatalf("unexpected merged agent: %+v", agent)
+	}
+	if _, ok := cfg.Agents["codex"]; ok {
+		t.Fatalf("expected unused built-in codex to be omitted")
+	}
+	sources := cfg.agentSources["claude"]
+	if sources["type"] != "built-in" || sources["model"] != filepath.Join("..", "agents.yaml") {
+		t.Fatalf("unexpected sources: %v", sources)
+	}
+}
+
+func TestLoadConfigFindsRepoAgentsFromWorkdir(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeFile(t, filepath.Join(repo, "agents.yaml"), `agents:
+  echo:
+    type: generic
+    command: printf
+`)
+	configPath := filepath.Join(t.TempDir(), ".moleman", "configs", "default.yaml")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeFile(t, configPath, `version: 1
+
+workflow:
+  - type: agent
+    name: say
+    agent: echo
+    input:
+      prompt: "hi"
+    output:
+      toNext: true
+`)
+
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Fatalf("expected unknown agent without a workdir, got %v", err)
+	}
+	cfg, err := LoadConfigWithOptions(configPath, LoadOptions{Workdir: filepath.Join(repo, "src")})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if agent := cfg.Agents["echo"]; agent.Type != "generic" || agent.Command != "printf" {
+		t.Fatalf("unexpected agent: %+v", agent)
+	}
+	if got := cfg.agentSources["echo"]["command"]; got != filepath.Join(repo, "agents.yaml") {
+		t.Fatalf("unexpected source: %q", got)
+	}
+}
+
+func TestLoadConfigUsesAgentsFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	writeFile(t, filepath.Join(tempDir, "agents.yaml"), `agents:
+  echo:
+    type: generic
+    command: cat
+`)
+	if err := os.MkdirAll(filepath.Join(tempDir, "shared"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeFile(t, filepath.Join(tempDir, "shared", "agents.yaml"), `agents:
+  echo:
+    type: generic
+    command: printf
+`)
+	config := `version: 1
+agentsFile: %s
+
+workflow:
+  - type: agent
+    name: write
+    agent: echo
+    input:
+      prompt: "write"
+    output:
+      toNext: true
+`
+	writeFile(t, filepath.Join(tempDir, "moleman.yaml"), fmt.Sprintf(config, "shared/agents.yaml"))
+	cfg, err := LoadConfig(filepath.Join(tempDir, "moleman.yaml"))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.Agents["echo"].Command != "printf" {
+		t.Fatalf("expected agentsFile to replace agents.yaml, got %+v", cfg.Agents["echo"])
+	}
+
+	writeFile(t, filepath.Join(tempDir, "moleman.yaml"), fmt.Sprintf(config, "missing.yaml"))
+	if _, err := LoadConfig(filepath.Join(tempDir, "moleman.yaml")); err == nil || !strings.Contains(err.Error(), "agentsFile not found") {
+		t.Fatalf("expected missing agentsFile error, got %v", err)
+	}
+}
+
+func TestLoadConfigReportsPositionsAndNodePaths(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	config := `version: 1
+
+workflow:
+  - type: loop
+    %s: 2
+    until: "true"
+    body:
+      - type: agent
+        name: review
+        agent: claude
+        input:
+          prompt: "review"
+        output: {}
+`
+	writeFile(t, configPath, fmt.Sprintf(config, "maxIter"))
+	_, err := LoadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), configPath+":5:5: workflow[0].maxIter is not a known field") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+
+	writeFile(t, configPath, fmt.Sprintf(config, "maxIters"))
+	_, err = LoadConfig(configPath)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("expected config error, got %v", err)
+	}
+	if configErr.Path != "workflow[0].body[0].output" || configErr.Line != 13 || configErr.Column != 9 {
+		t.Fatalf("unexpected error location: %+v", configErr)
+	}
+}
+
+func TestLoadConfigWithVarsBindsParams(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, `version: 1
+
+params:
+  iters:
+    type: int
+    default: 2
+  reviewer:
+    default: echo
+
+agents:
+  echo:
+    type: generic
+    command: printf
+  shout:
+    type: generic
+    command: echo
+
+workflow:
+  - type: loop
+    maxIters: "{{ .params.iters }}"
+    until: "true"
+    body:
+      - type: agent
+        name: review
+        agent: "{{ .params.reviewer }}"
+        input:
+          prompt: "review"
+        output:
+          toNext: true
+`)
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if loop := cfg.Workflow[0]; loop.MaxIters != 2 || loop.Body[0].Agent != "echo" {
+		t.Fatalf("expected defaults to be bound, got %+v", loop)
+	}
+
+	vars, err := ParseVars([]string{"iters=5", "reviewer=shout"}, "")
+	if err != nil {
+		t.Fatalf("parse vars: %v", err)
+	}
+	cfg, err = LoadConfigWithVars(configPath, vars)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if loop := cfg.Workflow[0]; loop.MaxIters != 5 || loop.Body[0].Agent != "shout" {
+		t.Fatalf("expected vars to be bound, got %+v", loop)
+	}
+	if cfg.paramValues["iters"] != 5 {
+		t.Fatalf("expected typed param values, got %#v", cfg.paramValues)
+	}
+
+	for _, bad := range []map[string]any{{"iters": "many"}, {"unknown": "x"}, {"reviewer": "missing"}} {
+		if _, err := LoadConfigWithVars(configPath, bad); err == nil {
+			t.Fatalf("expected error for vars %v", bad)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package moleman
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigError is a config problem at a node path such as
+// workflow[2].body[0].input. File, Line and Column are set when the path
+// can be located in the source YAML.
+type ConfigError struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		if e.Line > 0 {
+			fmt.Fprintf(&b, ":%d:%d", e.Line, e.Column)
+		}
+		b.WriteString(": ")
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		b.WriteString(" ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+func configErrorf(path, format string, args ...any) *ConfigError {
+	return &ConfigError{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+// locateConfigError fills in file and position for config errors, looking
+// their paths up in doc.
+func locateConfigError(err error, file string, doc *yaml.Node) error {
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		return err
+	}
+	configErr.File = file
+	if configErr.Line == 0 {
+		if node := lookupYAMLPath(doc, configErr.Path); node != nil {
+			configErr.Line, configErr.Column = node.Line, node.Column
+		}
+	}
+	return err
+}
+
+var yamlPathSegment = regexp.MustCompile(`([^.\[\]]+)|\[(\d+)\]`)
+
+// lookupYAMLPath returns the key (for map entries) or value node at path.
+// When the full path is missing it falls back to the nearest ancestor below
+// the top level, e.g. the workflow item of a missing input.
+func lookupYAMLPath(doc *yaml.Node, path string) *yaml.Node {
+	if doc == nil || path == "" {
+		return nil
+	}
+	current := doc
+	if current.Kind == yaml.DocumentNode && len(current.Content) > 0 {
+		current = current.Content[0]
+	}
+	var found *yaml.Node
+	depth := 0
+	for _, match := range yamlPathSegment.FindAllStringSubmatch(path, -1) {
+		var key, value *yaml.Node
+		switch {
+		case match[2] != "" && current.Kind == yaml.SequenceNode:
+			idx, _ := strconv.Atoi(match[2])
+			if idx < len(current.Content) {
+				value = current.Content[idx]
+				key = value
+			}
+		case match[1] != "" && current.Kind == yaml.MappingNode:
+			for i := 0; i+1 < len(current.Content); i += 2 {
+				if current.Content[i].Value == match[1] {
+					key, value = current.Content[i], current.Content[i+1]
+					break
+				}
+			}
+		}
+		if value == nil {
+			break
+		}
+		found, current = key, value
+		depth++
+	}
+	if depth < 2 && depth < len(yamlPathSegment.FindAllString(path, -1)) {
+		return nil
+	}
+	return found
+}
+
+// yamlNodePath returns the path of the map key or value starting on line,
+// preferring a key named key.
+func yamlNodePath(doc *yaml.Node, line int, key string) (string, *yaml.Node) {
+	var walk func(node *yaml.Node, path string) (string, *yaml.Node)
+	walk = func(node *yaml.Node, path string) (string, *yaml.Node) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				if found, at := walk(child, path); at != nil {
+					return found, at
+				}
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				k, v := node.Content[i], node.Content[i+1]
+				childPath := k.Value
+				if path != "" {
+					childPath = path + "." + k.Value
+				}
+				if k.Line == line && (key == "" || k.Value == key) {
+					return childPath, k
+				}
+				if found, at := walk(v, childPath); at != nil {
+					return found, at
+				}
+			}
+		case yaml.SequenceNode:
+			for idx, child := range node.Content {
+				childPath := fmt.Sprintf("%s[%d]", path, idx)
+				if found, at := walk(child, childPath); at != nil {
+					return found, at
+				}
+			}
+		default:
+			if key == "" && node.Line == line {
+				return path, node
+			}
+		}
+		return "", nil
+	}
+	return walk(doc, "")
+}
+
+var (
+	yamlTypeErrorLine    = regexp.MustCompile(`^line (\d+): (.*)$`)
+	yamlUnknownFieldText = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+)
+
+// decodeStrictYAML decodes raw into out rejecting unknown fields, and
+// returns the parsed document for locating later errors. Errors carry file,
+// line, column and node path.
+func decodeStrictYAML(file string, raw []byte, out any) (*yaml.Node, error) {
+	doc, err := parseYAML(file, raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStrictYAML(file, raw, doc, out, nil); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func parseYAML(file string, raw []byte) (*yaml.Node, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(raw, doc); err != nil {
+		return nil, fmt.Errorf("%s: parse yaml: %w", file, err)
+	}
+	return doc, nil
+}
+
+// checkStrictYAML decodes raw into out with KnownFields. Type errors on
+// skipLines, which were rewritten in doc, are ignored.
+func checkStrictYAML(file string, raw []byte, doc *yaml.Node, out any, skipLines map[int]bool) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	err := decoder.Decode(out)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return fmt.Errorf("%s: parse yaml: %w", file, err)
+	}
+	errs := []error{}
+	for _, text := range typeErr.Errors {
+		match := yamlTypeErrorLine.FindStringSubmatch(text)
+		if match == nil {
+			errs = append(errs, &ConfigError{File: file, Message: text})
+			continue
+		}
+		line, _ := strconv.Atoi(match[1])
+		if skipLines[line] && !yamlUnknownFieldText.MatchString(match[2]) {
+			continue
+		}
+		configErr := &ConfigError{File: file, Line: line, Column: 1, Message: match[2]}
+		key := ""
+		if field := yamlUnknownFieldText.FindStringSubmatch(match[2]); field != nil {
+			key = field[1]
+			configErr.Message = "is not a known field"
+		}
+		if path, node := yamlNodePath(doc, line, key); node != nil {
+			configErr.Path, configErr.Column = path, node.Column
+		}
+		errs = append(errs, configErr)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,197 @@
+package moleman
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigV2 is the version 2 config format. Steps are identified by id, list
+// their inputs and outputs as maps, and may declare an output type. It is
+// converted to Config on load, so the rest of moleman sees one model.
+type ConfigV2 struct {
+	Version    int                    `yaml:"version"`
+	AgentsFile string                 `yaml:"agentsFile,omitempty"`
+	Params     map[string]ParamSpec   `yaml:"params,omitempty"`
+	Agents     map[string]AgentConfig `yaml:"agents"`
+	Limits     LimitsSpec             `yaml:"limits,omitempty"`
+	Redact     []string               `yaml:"redact,omitempty"`
+	Profiles   map[string]ProfileSpec `yaml:"profiles,omitempty"`
+	Workflow   []Step                 `yaml:"workflow,omitempty"`
+	Workflows  map[string][]Step      `yaml:"workflows,omitempty"`
+}
+
+// Step is a version 2 workflow step: an agent step, or a loop when Loop is
+// set.
+type Step struct {
+	ID      string      `yaml:"id,omitempty"`
+	Agent   string      `yaml:"agent,omitempty"`
+	Inputs  InputSpec   `yaml:"inputs,omitempty"`
+	Outputs StepOutputs `yaml:"outputs,omitempty"`
+	Session SessionSpec `yaml:"session,omitempty"`
+	Loop    *LoopSpec   `yaml:"loop,omitempty"`
+}
+
+// StepOutputs routes a step's output to any number of targets.
+type StepOutputs struct {
+	Type   string `yaml:"type,omitempty"`
+	Next   bool   `yaml:"next,omitempty"`
+	File   string `yaml:"file,omitempty"`
+	Stdout bool   `yaml:"stdout,omitempty"`
+}
+
+type LoopSpec struct {
+	MaxIters int    `yaml:"maxIters"`
+	Until    string `yaml:"until"`
+	Steps    []Step `yaml:"steps"`
+}
+
+const latestConfigVersion = 2
+
+var outputTypes = []string{"text", "json"}
+
+// configVersion reads the version of a parsed config, 0 when missing.
+func configVersion(doc *yaml.Node) int {
+	if len(doc.Content) == 0 {
+		return 0
+	}
+	value := yamlMapValue(doc.Content[0], "version")
+	if value == nil {
+		return 0
+	}
+	version, _ := strconv.Atoi(value.Value)
+	return version
+}
+
+func (v2 *ConfigV2) toConfig() *Config {
+	cfg := &Config{
+		Version:    v2.Version,
+		AgentsFile: v2.AgentsFile,
+		Params:     v2.Params,
+		Agents:     v2.Agents,
+		Limits:     v2.Limits,
+		Redact:     v2.Redact,
+		Profiles:   v2.Profiles,
+		Workflow:   stepsToItems(v2.Workflow),
+	}
+	if v2.Workflows != nil {
+		cfg.Workflows = map[string][]WorkflowItem{}
+		for name, steps := range v2.Workflows {
+			cfg.Workflows[name] = stepsToItems(steps)
+		}
+	}
+	return cfg
+}
+
+// validateStepKinds rejects loop steps that also set agent step fields,
+// which the conversion to WorkflowItem would drop.
+func (v2 *ConfigV2) validateStepKinds() error {
+	if err := validateStepKinds("workflow", v2.Workflow); err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(v2.Workflows) {
+		if err := validateStepKinds("workflows."+name, v2.Workflows[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateStepKinds(path string, steps []Step) error {
+	for idx, step := range steps {
+		stepPath := fmt.Sprintf("%s[%d]", path, idx)
+		if step.Loop == nil {
+			continue
+		}
+		fields := []string{}
+		if step.Agent != "" {
+			fields = append(fields, "agent")
+		}
+		if step.Inputs != (InputSpec{}) {
+			fields = append(fields, "inputs")
+		}
+		if step.Outputs != (StepOutputs{}) {
+			fields = append(fields, "outputs")
+		}
+		if step.Session != (SessionSpec{}) {
+			fields = append(fields, "session")
+		}
+		if len(fields) > 0 {
+			return configErrorf(stepPath, "cannot set %s together with loop", strings.Join(fields, ", "))
+		}
+		if err := validateStepKinds(stepPath+".loop.steps", step.Loop.Steps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stepsToItems(steps []Step) []WorkflowItem {
+	if steps == nil {
+		return nil
+	}
+	items := make([]WorkflowItem, 0, len(steps))
+	for _, step := range steps {
+		if step.Loop != nil {
+			items = append(items, WorkflowItem{
+				Type:     "loop",
+				Name:     step.ID,
+				MaxIters: step.Loop.MaxIters,
+				Until:    step.Loop.Until,
+				Body:     stepsToItems(step.Loop.Steps),
+			})
+			continue
+		}
+		items = append(items, WorkflowItem{
+			Type:    "agent",
+			Name:    step.ID,
+			Agent:   step.Agent,
+			Input:   step.Inputs,
+			Session: step.Session,
+			Output: OutputSpec{
+				ToNext: step.Outputs.Next,
+				File:   step.Outputs.File,
+				Stdout: step.Outputs.Stdout,
+				Type:   step.Outputs.Type,
+			},
+		})
+	}
+	return items
+}
+
+var v2PathRewrites = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`\.body\[`), ".loop.steps["},
+	{regexp.MustCompile(`\.(maxIters|until)$`), ".loop.$1"},
+	{regexp.MustCompile(`\.name$`), ".id"},
+	{regexp.MustCompile(`\.input(\.|$)`), ".inputs$1"},
+	{regexp.MustCompile(`\.output(\.|$)`), ".outputs$1"},
+	{regexp.MustCompile(`\.outputs\.toNext$`), ".outputs.next"},
+}
+
+var v2MessageRewrites = strings.NewReplacer(
+	"name is required", "id is required",
+	"duplicates workflow name", "duplicates step id",
+	"loop body is empty", "loop steps is empty",
+	"toNext", "next",
+)
+
+// toV2ConfigError rewrites workflow paths and wording of a config error
+// from the internal model to the version 2 format.
+func toV2ConfigError(err error) error {
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || !strings.HasPrefix(configErr.Path, "workflow") {
+		return err
+	}
+	for _, rewrite := range v2PathRewrites {
+		configErr.Path = rewrite.pattern.ReplaceAllString(configErr.Path, rewrite.replace)
+	}
+	configErr.Message = v2MessageRewrites.Replace(configErr.Message)
+	return err
+}
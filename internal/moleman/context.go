@@ -1,22 +1,55 @@
 package moleman
 
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
 type RunContext struct {
-	Input       string
-	Outputs     map[string]any
-	LastOutput  string
-	Sessions    map[string]string
-	RunDir      string
-	Workdir     string
-	Verbose     bool
-	NodeResults []NodeResult
+	Context    context.Context
+	Input      string
+	Outputs    map[string]any
+	LastOutput string
+	Sessions   map[string]string
+	// CodexSessions maps codex agent names to the session each last ran in.
+	CodexSessions map[string]string
+	RunDir        string
+	Workdir       string
+	Verbose       bool
+	Stdout        io.Writer
+	Stderr        io.Writer
+	Budget        *Budget
+	Events        *EventLog
+	Replay        *replaySource
+	ReplayAgents  map[string]*replaySource
+	Mocks         *mockSet
+	BeforeWrite   func(path string)
+	Params        map[string]any
+	Redactor      *redactor
+	Iteration     []int
+	Location      []int
+	NodeResults   []NodeResult
 }
 
+// NodeResult records one execution of an agent node. Log paths are relative
+// to the run directory; OutputFile is as rendered from output.file.
 type NodeResult struct {
-	Name     string
-	Agent    string
-	ExitCode int
-	Duration string
-	Command  string
+	Name       string    `json:"name"`
+	Agent      string    `json:"agent"`
+	Status     string    `json:"status"`
+	Iteration  []int     `json:"iteration,omitempty"`
+	ExitCode   int       `json:"exitCode"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+	Command    string    `json:"command"`
+	Usage      *Usage    `json:"usage,omitempty"`
+	StdoutLog  string    `json:"stdoutLog,omitempty"`
+	StderrLog  string    `json:"stderrLog,omitempty"`
+	OutputFile string    `json:"outputFile,omitempty"`
 }
 
 func (ctx *RunContext) TemplateData() map[string]any {
@@ -24,8 +57,55 @@ func (ctx *RunContext) TemplateData() map[string]any {
 		"input": map[string]any{
 			"prompt": ctx.Input,
 		},
+		"params":   ctx.Params,
 		"outputs":  ctx.Outputs,
 		"last":     ctx.LastOutput,
 		"sessions": ctx.Sessions,
+		"run":      ctx.Budget.TemplateData(),
+	}
+}
+
+// render executes a workflow template against the run's template data.
+// ${VAR} is left alone so prompts can carry shell snippets; templates read
+// the environment with {{ env "VAR" }}.
+func (ctx *RunContext) render(input string) (string, error) {
+	return renderTemplate(input, ctx.TemplateData(), ctx.Redactor)
+}
+
+// renderAgentField expands ${VAR} references in an agent field and then
+// renders it as a template.
+func (ctx *RunContext) renderAgentField(input string) (string, error) {
+	expanded, err := expandEnvRefs(input, ctx.Redactor)
+	if err != nil {
+		return "", err
+	}
+	return ctx.render(expanded)
+}
+
+func (ctx *RunContext) stdout() io.Writer {
+	if ctx.Stdout == nil {
+		return os.Stdout
+	}
+	return ctx.Stdout
+}
+
+func (ctx *RunContext) stderr() io.Writer {
+	if ctx.Stderr == nil {
+		return os.Stderr
+	}
+	return ctx.Stderr
+}
+
+// workflowPath renders item indices as a config path such as
+// workflow[2].body[0].
+func workflowPath(location []int) string {
+	parts := make([]string, 0, len(location))
+	for idx, pos := range location {
+		if idx == 0 {
+			parts = append(parts, fmt.Sprintf("workflow[%d]", pos))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("body[%d]", pos))
 	}
+	return strings.Join(parts, ".")
 }
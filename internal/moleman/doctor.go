@@ -1,27 +1,502 @@
 package moleman
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 )
 
+// DoctorCheck is one line of the doctor report. Status is pass, warn or
+// fail.
+type DoctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+
+	err error
+}
+
+// DoctorReport lists the checks doctor ran against a config.
+type DoctorReport struct {
+	Config string        `json:"config"`
+	Checks []DoctorCheck `json:"checks"`
+}
+
+// versionProbeTimeout bounds each `<agent> --version` call.
+const versionProbeTimeout = 10 * time.Second
+
+func (r *DoctorReport) pass(name, format string, args ...any) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: "pass", Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *DoctorReport) warn(name, format string, args ...any) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: "warn", Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *DoctorReport) fail(name string, err error) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: "fail", Message: err.Error(), err: err})
+}
+
+// Err returns the first failing check's error, or nil when nothing failed.
+func (r *DoctorReport) Err() error {
+	for _, check := range r.Checks {
+		if check.Status == "fail" {
+			return check.err
+		}
+	}
+	return nil
+}
+
+// Doctor checks a config and its environment and returns the first failure.
 func Doctor(configPath string) error {
+	return RunDoctor(configPath, "", LoadOptions{}).Err()
+}
+
+// RunDoctor loads the config and checks the agent CLIs, git, the runs
+// directory, schema files, templates and the workflows themselves. Nothing
+// past the config check runs when the config does not load. workdir is the
+// directory runs use, the config dir when empty.
+func RunDoctor(configPath, workdir string, opts LoadOptions) *DoctorReport {
+	report := &DoctorReport{Config: configPath}
 	if _, err := os.Stat(configPath); err != nil {
-		return fmt.Errorf("config not found: %s", configPath)
+		report.fail("config", fmt.Errorf("config not found: %s", configPath))
+		return report
+	}
+	if opts.Workdir == "" {
+		opts.Workdir = workdir
+	}
+	cfg, err := LoadConfigWithOptions(configPath, opts)
+	if err == nil {
+		err = ValidateConfig(cfg)
 	}
-	cfg, err := LoadConfig(configPath)
 	if err != nil {
-		return err
+		report.fail("config", err)
+		return report
 	}
-	if err := ValidateConfig(cfg); err != nil {
-		return err
+	sets := workflowSets(cfg)
+	nodes := 0
+	for _, set := range sets {
+		nodes += len(flattenAgentNodes(set.items))
+	}
+	report.pass("config", "%s: version %d, %d workflow(s), %d agent node(s)", configPath, cfg.Version, len(sets), nodes)
+
+	if workdir == "" {
+		workdir = ConfigDir(configPath)
 	}
-	workdir := ConfigDir(configPath)
 	if workdir == "" {
 		workdir = "."
 	}
-	if err := ensureAgentCommands(cfg, workdir); err != nil {
+	used := doctorUsedAgents(cfg)
+	for _, name := range used {
+		checkAgentCommand(report, name, cfg.Agents[name], workdir)
+	}
+	checkGitRepo(report, cfg, used, workdir)
+	checkRunsDir(report, RunsDir(workdir))
+	checkSchemaFiles(report, cfg, used, workdir)
+	checkTemplates(report, cfg, sets)
+	checkUnusedAgents(report, cfg, used)
+	checkReachable(report, sets)
+	return report
+}
+
+// doctorUsedAgents lists the agents any workflow runs, sorted.
+func doctorUsedAgents(cfg *Config) []string {
+	used := map[string]struct{}{}
+	for _, set := range workflowSets(cfg) {
+		collectAgentNames(set.items, used)
+	}
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkAgentCommand looks the agent's command up and, for codex and claude,
+// reports what `<command> --version` prints.
+func checkAgentCommand(report *DoctorReport, name string, agent AgentConfig, workdir string) {
+	check := "agent " + name
+	if agent.Type == "replay" {
+		report.pass(check, "replays run %s", agent.Run)
+		return
+	}
+	command, err := expandEnvRefs(resolveAgentCommand(agent), nil)
+	if err != nil {
+		report.fail(check, fmt.Errorf("agent %s command: %w", name, err))
+		return
+	}
+	if command == "" {
+		report.fail(check, fmt.Errorf("agent %s has no command configured", name))
+		return
+	}
+	if err := commandAvailable(command, workdir); err != nil {
+		report.fail(check, fmt.Errorf("agent %s command not found: %s (%w)", name, command, err))
+		return
+	}
+	if agent.Type != "codex" && agent.Type != "claude" {
+		report.pass(check, "%s found", command)
+		return
+	}
+	version, err := probeVersion(command, workdir)
+	if err != nil {
+		report.warn(check, "%s --version failed: %v", command, err)
+		return
+	}
+	report.pass(check, "%s: %s", command, version)
+}
+
+func probeVersion(command, workdir string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command, "--version")
+	cmd.Dir = workdir
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("timed out after %s", versionProbeTimeout)
+	}
+	if err != nil {
+		return "", err
+	}
+	version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if version == "" {
+		return "", fmt.Errorf("printed nothing")
+	}
+	return version, nil
+}
+
+// checkGitRepo fails when codex runs outside a git repository, since codex
+// exec refuses to unless given --skip-git-repo-check. Agents that only read
+// git (git diff in prompts or allowed tools) get a warning.
+func checkGitRepo(report *DoctorReport, cfg *Config, used []string, workdir string) {
+	if root := runGitCommand(workdir, "rev-parse", "--show-toplevel"); root != "" {
+		report.pass("git", "repository at %s", root)
+		return
+	}
+	readers := []string{}
+	for _, name := range used {
+		agent := cfg.Agents[name]
+		if agent.Type == "codex" && !isOneOf("--skip-git-repo-check", agent.Args) {
+			report.fail("git", fmt.Errorf("%s is not a git repository; agent %s (codex) needs one or --skip-git-repo-check", workdir, name))
+			return
+		}
+		if strings.Contains(strings.Join(agent.Args, " "), "git ") {
+			readers = append(readers, name)
+		}
+	}
+	for _, set := range workflowSets(cfg) {
+		for _, item := range flattenAgentNodes(set.items) {
+			if strings.Contains(item.Input.Prompt, "git ") {
+				readers = append(readers, item.Name)
+			}
+		}
+	}
+	if len(readers) > 0 {
+		report.warn("git", "%s is not a git repository but %s use git", workdir, strings.Join(readers, ", "))
+		return
+	}
+	report.pass("git", "not a git repository; no agent needs one")
+}
+
+// checkRunsDir checks that run directories can be created, without creating
+// any: the nearest existing ancestor of runsDir must be writable.
+func checkRunsDir(report *DoctorReport, runsDir string) {
+	dir := runsDir
+	for {
+		if info, err := os.Stat(dir); err == nil {
+			if !info.IsDir() {
+				report.fail("runs dir", fmt.Errorf("%s is not a directory", dir))
+				return
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	probe, err := os.CreateTemp(dir, ".moleman-doctor-*")
+	if err != nil {
+		report.fail("runs dir", fmt.Errorf("%s is not writable: %w", runsDir, err))
+		return
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	report.pass("runs dir", "%s is writable", runsDir)
+}
+
+// checkSchemaFiles parses every JSON schema the used agents reference
+// (outputSchema, --json-schema) and any schemas/*.json next to the config.
+func checkSchemaFiles(report *DoctorReport, cfg *Config, used []string, workdir string) {
+	type schemaRef struct {
+		label  string
+		path   string
+		inline string
+	}
+	refs := []schemaRef{}
+	resolve := func(path string) string {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workdir, path)
+		}
+		return filepath.Clean(path)
+	}
+	for _, name := range used {
+		agent := cfg.Agents[name]
+		if agent.OutputSchema != "" {
+			path, err := expandEnvRefs(agent.OutputSchema, nil)
+			if err == nil {
+				path, err = RenderTemplate(path, map[string]any{})
+			}
+			if err != nil {
+				report.fail("schema "+agent.OutputSchema, fmt.Errorf("agent %s output schema error: %w", name, err))
+				continue
+			}
+			refs = append(refs, schemaRef{label: agent.OutputSchema, path: resolve(path)})
+		}
+		for idx, arg := range agent.Args {
+			if arg != "--json-schema" || idx+1 >= len(agent.Args) {
+				continue
+			}
+			value := strings.TrimSpace(agent.Args[idx+1])
+			if strings.HasPrefix(value, "{") {
+				refs = append(refs, schemaRef{label: fmt.Sprintf("agent %s --json-schema", name), inline: value})
+			} else {
+				refs = append(refs, schemaRef{label: value, path: resolve(value)})
+			}
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(workdir, "schemas", "*.json"))
+	for _, match := range matches {
+		rel, err := filepath.Rel(workdir, match)
+		if err != nil {
+			rel = match
+		}
+		refs = append(refs, schemaRef{label: filepath.ToSlash(rel), path: filepath.Clean(match)})
+	}
+
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		key := ref.path
+		if key == "" {
+			key = ref.label
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		raw := []byte(ref.inline)
+		if ref.path != "" {
+			var err error
+			if raw, err = os.ReadFile(ref.path); err != nil {
+				report.fail("schema "+ref.label, fmt.Errorf("read schema %s: %w", ref.label, err))
+				continue
+			}
+		}
+		var schema any
+		if err := json.Unmarshal(raw, &schema); err != nil {
+			report.fail("schema "+ref.label, fmt.Errorf("schema %s is not valid JSON: %w", ref.label, err))
+			continue
+		}
+		if _, ok := schema.(map[string]any); !ok {
+			report.fail("schema "+ref.label, fmt.Errorf("schema %s is not a JSON object", ref.label))
+			continue
+		}
+		report.pass("schema "+ref.label, "valid JSON")
+	}
+}
+
+// checkTemplates renders every template of every workflow against stub
+// data: params as resolved, placeholder text for outputs and an empty
+// structured_output for their _json forms.
+func checkTemplates(report *DoctorReport, cfg *Config, sets []workflowSet) {
+	budget, _ := newBudget(LimitsSpec{}, time.Now())
+	count := 0
+	for _, set := range sets {
+		outputs := map[string]any{"__previous__": "<previous output>", "__previous_json__": normalizeStructuredOutput(map[string]any{})}
+		for _, name := range producedNames(set.items) {
+			outputs[name] = fmt.Sprintf("<output of %s>", name)
+			outputs[name+"_json"] = normalizeStructuredOutput(map[string]any{})
+		}
+		data := map[string]any{
+			"input":    map[string]any{"prompt": "<prompt>"},
+			"params":   cfg.paramValues,
+			"outputs":  outputs,
+			"last":     "<previous output>",
+			"sessions": map[string]string{"claude": "<claude session id>"},
+			"run":      budget.TemplateData(),
+		}
+		var walk func(items []WorkflowItem, location []int) bool
+		walk = func(items []WorkflowItem, location []int) bool {
+			for idx, item := range items {
+				path := append(append([]int(nil), location...), idx)
+				if item.Type == "loop" {
+					if !walk(item.Body, path) {
+						return false
+					}
+					continue
+				}
+				agent := cfg.Agents[item.Agent]
+				for _, field := range []struct{ name, text string }{
+					{"input.prompt", item.Input.Prompt},
+					{"input.file", item.Input.File},
+					{"output.file", item.Output.File},
+					{"agent.outputSchema", agent.OutputSchema},
+					{"agent.outputFile", agent.OutputFile},
+				} {
+					if field.text == "" {
+						continue
+					}
+					count++
+					if _, err := RenderTemplate(field.text, data); err != nil {
+						report.fail("templates", fmt.Errorf("%s %s %s: %w", workflowSetPath(set, path), item.Name, field.name, err))
+						return false
+					}
+				}
+			}
+			return true
+		}
+		if !walk(set.items, nil) {
+			return
+		}
+	}
+	report.pass("templates", "%d template(s) render", count)
+}
+
+// checkUnusedAgents warns about agents declared in the config that no
+// workflow runs and no used agent extends.
+func checkUnusedAgents(report *DoctorReport, cfg *Config, used []string) {
+	needed := map[string]bool{}
+	for _, name := range used {
+		for current := name; current != "" && !needed[current]; current = cfg.configAgents[current].Extends {
+			needed[current] = true
+		}
+	}
+	unused := []string{}
+	for _, name := range sortedKeys(cfg.configAgents) {
+		if !needed[name] {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) > 0 {
+		report.warn("unused agents", "%s declared but never run", strings.Join(unused, ", "))
+		return
+	}
+	report.pass("unused agents", "every declared agent is used")
+}
+
+// checkReachable warns about nodes after a loop whose until can never be met:
+// it reads outputs no node produces, or is constant false. Such a loop always
+// exhausts and fails the run.
+func checkReachable(report *DoctorReport, sets []workflowSet) {
+	warned := false
+	for _, set := range sets {
+		produced := map[string]bool{}
+		for _, name := range producedNames(set.items) {
+			produced[name] = true
+		}
+		var blocker string
+		unreachable := []string{}
+		var walk func(items []WorkflowItem, location []int)
+		walk = func(items []WorkflowItem, location []int) {
+			for idx, item := range items {
+				path := append(append([]int(nil), location...), idx)
+				if blocker != "" {
+					for _, node := range flattenAgentNodes([]WorkflowItem{item}) {
+						unreachable = append(unreachable, node.Name)
+					}
+					continue
+				}
+				if item.Type != "loop" {
+					continue
+				}
+				walk(item.Body, path)
+				if reason := untilNeverMet(item.Until, produced); reason != "" && blocker == "" {
+					blocker = fmt.Sprintf("%s until %s", workflowSetPath(set, path), reason)
+				}
+			}
+		}
+		walk(set.items, nil)
+		if blocker == "" {
+			continue
+		}
+		warned = true
+		if len(unreachable) == 0 {
+			report.warn("reachability", "%s, so the run always fails", blocker)
+			continue
+		}
+		report.warn("reachability", "%s never run: %s", strings.Join(unreachable, ", "), blocker)
+	}
+	if !warned {
+		report.pass("reachability", "every node is reachable")
+	}
+}
+
+// untilNeverMet explains why an until expression can never be true, or
+// returns "".
+func untilNeverMet(until string, produced map[string]bool) string {
+	refs, err := conditionOutputRefs(until)
+	if err != nil {
+		return ""
+	}
+	for _, ref := range refs {
+		if name := strings.TrimSuffix(ref, "_json"); !produced[name] && !strings.HasPrefix(ref, "__previous") {
+			return fmt.Sprintf("reads outputs.%s, which no node produces", ref)
+		}
+	}
+	expr := strings.TrimSpace(until)
+	expr = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(expr, "{{"), "}}"))
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return ""
+	}
+	constant := true
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name != "true" && ident.Name != "false" {
+			constant = false
+		}
+		return constant
+	})
+	if value, err := EvalCondition(until, map[string]any{}); constant && err == nil && !value {
+		return "is always false"
+	}
+	return ""
+}
+
+// PrintDoctorReport writes the report as a table or json.
+func PrintDoctorReport(w io.Writer, report *DoctorReport, format string) error {
+	switch format {
+	case "", "text":
+		tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+		fmt.Fprintln(tw, "STATUS\tCHECK\tDETAILS")
+		for _, check := range report.Checks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", check.Status, check.Name, strings.ReplaceAll(check.Message, "\n", " "))
+		}
+		return tw.Flush()
+	case "json":
+		raw, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal doctor report: %w", err)
+		}
+		_, err = fmt.Fprintf(w, "%s\n", raw)
 		return err
+	default:
+		return fmt.Errorf("unknown format: %s (want text or json)", format)
 	}
-	return nil
+}
+
+// workflowSetPath is workflowPath rooted at the workflow set, e.g.
+// workflows.fix[0].body[1].
+func workflowSetPath(set workflowSet, location []int) string {
+	return set.path + strings.TrimPrefix(workflowPath(location), "workflow")
 }
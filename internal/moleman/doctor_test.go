@@ -33,3 +33,121 @@ workflow: []
 		t.Fatalf("expected agents validation error, got %v", err)
 	}
 }
+
+func TestRunDoctorReportsChecks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	bin := t.TempDir()
+	writeFile(t, filepath.Join(bin, "codex"), "#!/bin/sh\necho 'codex-cli 1.2.3'\n")
+	if err := os.Chmod(filepath.Join(bin, "codex"), 0o755); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "schemas"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "schemas", "review.json"), `{"type": "object"}`)
+	writeFile(t, filepath.Join(dir, "schemas", "broken.json"), `{"type": `)
+	configPath := filepath.Join(dir, "moleman.yaml")
+	writeFile(t, configPath, `version: 1
+
+agents:
+  reviewer:
+    extends: codex
+    outputSchema: schemas/review.json
+  spare:
+    type: generic
+    command: cat
+
+workflow:
+  - type: loop
+    maxIters: 2
+    until: "outputs.check_json.structured_output.ok == true"
+    body:
+      - type: agent
+        name: review
+        agent: reviewer
+        input:
+          prompt: "Review {{ .outputs.review_json.structured_output.notes }}"
+        output:
+          toNext: true
+  - type: agent
+    name: write
+    agent: codex
+    input:
+      from: review
+    output:
+      stdout: true
+`)
+	report := RunDoctor(configPath, "", LoadOptions{})
+	statuses := map[string]string{}
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status + ": " + check.Message
+	}
+	want := map[string]string{
+		"config":                     "pass: ",
+		"agent codex":                "pass: codex: codex-cli 1.2.3",
+		"agent reviewer":             "pass: codex: codex-cli 1.2.3",
+		"git":                        "fail: ",
+		"runs dir":                   "pass: ",
+		"schema schemas/review.json": "pass: valid JSON",
+		"schema schemas/broken.json": "fail: schema schemas/broken.json is not valid JSON",
+		"templates":                  "pass: 2 template(s) render",
+		"unused agents":              "warn: spare declared but never run",
+		"reachability":               "warn: write never run: workflow[0] until reads outputs.check_json, which no node produces",
+	}
+	for name, prefix := range want {
+		if !strings.HasPrefix(statuses[name], prefix) {
+			t.Fatalf("check %s: got %q, want prefix %q", name, statuses[name], prefix)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".moleman")); !os.IsNotExist(err) {
+		t.Fatalf("expected doctor not to create .moleman, got %v", err)
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "not a git repository") {
+		t.Fatalf("expected git failure first, got %v", err)
+	}
+}
+
+func TestRunDoctorChecksWorkdir(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	runGitCommand(repo, "init", "-q")
+	if _, err := os.Stat(filepath.Join(repo, ".git")); err != nil {
+		t.Skip("git init failed")
+	}
+	if err := os.MkdirAll(filepath.Join(repo, "schemas"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeFile(t, filepath.Join(repo, "schemas", "review.json"), `{"type": "object"}`)
+	configPath := filepath.Join(t.TempDir(), "moleman.yaml")
+	writeFile(t, configPath, `version: 1
+
+agents:
+  reviewer:
+    type: generic
+    command: cat
+    outputSchema: schemas/review.json
+
+workflow:
+  - type: agent
+    name: review
+    agent: reviewer
+    input:
+      prompt: "review"
+    output:
+      stdout: true
+`)
+	report := RunDoctor(configPath, repo, LoadOptions{})
+	if err := report.Err(); err != nil {
+		t.Fatalf("expected the workdir to be checked, got %v", err)
+	}
+	statuses := map[string]string{}
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status + ": " + check.Message
+	}
+	if !strings.HasPrefix(statuses["git"], "pass: ") || !strings.HasPrefix(statuses["schema schemas/review.json"], "pass: ") {
+		t.Fatalf("unexpected checks: %v", statuses)
+	}
+}
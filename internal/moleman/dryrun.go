@@ -0,0 +1,350 @@
+package moleman
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// dryRunPlanner walks the workflow once without invoking agents. Each node
+// is rendered against placeholder outputs from the nodes before it.
+type dryRunPlanner struct {
+	ctx      *RunContext
+	cfg      *Config
+	out      io.Writer
+	produced map[string]bool
+	later    map[string]bool
+	warnings []string
+	problems []string
+}
+
+// planSession records a placeholder for the session a planned node of
+// agentName leaves behind, so later nodes that resume it render like a run
+// would: codex sessions per agent, the claude session run-wide.
+func planSession(ctx *RunContext, agentName string, agent AgentConfig) {
+	switch agent.Type {
+	case "codex":
+		if ctx.CodexSessions == nil {
+			ctx.CodexSessions = map[string]string{}
+		}
+		ctx.CodexSessions[agentName] = "<codex session id>"
+	case "claude":
+		ctx.Sessions["claude"] = "<claude session id>"
+	}
+}
+
+// dryRunWorkflow prints the commands a run would execute to the run's stdout
+// and to plan.txt in the run dir. Templates that cannot be rendered fail the
+// dry run; references to outputs no earlier node produces are warnings.
+func dryRunWorkflow(ctx *RunContext, cfg *Config) error {
+	planFile, err := os.Create(filepath.Join(ctx.RunDir, "plan.txt"))
+	if err != nil {
+		return fmt.Errorf("create plan.txt: %w", err)
+	}
+	defer planFile.Close()
+
+	out := &redactWriter{redactor: ctx.Redactor, out: io.MultiWriter(ctx.stdout(), planFile)}
+	defer out.Flush()
+
+	p := &dryRunPlanner{
+		ctx:      ctx,
+		cfg:      cfg,
+		out:      out,
+		produced: map[string]bool{},
+		later:    map[string]bool{},
+	}
+	fmt.Fprintf(p.out, "Dry run: %d agent node(s), workdir %s\n\n", len(flattenAgentNodes(cfg.Workflow)), ctx.Workdir)
+	p.walk(cfg.Workflow, 0)
+	if agents := uncostedAgents(cfg); ctx.Budget.MaxCostUSD > 0 && len(agents) > 0 {
+		p.warnings = append(p.warnings, fmt.Sprintf("limits.maxCostUSD does not count agents that report no cost: %s", strings.Join(agents, ", ")))
+	}
+
+	if len(p.warnings) > 0 {
+		fmt.Fprintln(p.out, "\nWarnings:")
+		for _, warning := range p.warnings {
+			fmt.Fprintf(p.out, "  %s\n", warning)
+		}
+	}
+	if len(p.problems) > 0 {
+		fmt.Fprintln(p.out, "\nProblems:")
+		for _, problem := range p.problems {
+			fmt.Fprintf(p.out, "  %s\n", problem)
+		}
+		return fmt.Errorf("dry run found %d problem(s)", len(p.problems))
+	}
+	return nil
+}
+
+func (p *dryRunPlanner) walk(items []WorkflowItem, depth int) {
+	for idx, item := range items {
+		p.ctx.Location = append(p.ctx.Location, idx)
+		switch item.Type {
+		case "agent":
+			p.planAgent(item, depth)
+		case "loop":
+			p.planLoop(item, depth)
+		}
+		p.ctx.Location = p.ctx.Location[:len(p.ctx.Location)-1]
+	}
+}
+
+func (p *dryRunPlanner) planLoop(item WorkflowItem, depth int) {
+	path := workflowPath(p.ctx.Location)
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(p.out, "%s%s loop (maxIters %d, until: %s)\n", indent, path, item.MaxIters, item.Until)
+
+	// Nodes later in the body have run by the second iteration.
+	added := []string{}
+	for _, name := range producedNames(item.Body) {
+		if !p.produced[name] && !p.later[name] {
+			p.later[name] = true
+			added = append(added, name)
+		}
+	}
+	p.ctx.Iteration = append(p.ctx.Iteration, 1)
+	p.walk(item.Body, depth+1)
+	p.ctx.Iteration = p.ctx.Iteration[:len(p.ctx.Iteration)-1]
+	for _, name := range added {
+		delete(p.later, name)
+	}
+
+	refs, err := conditionOutputRefs(item.Until)
+	if err != nil {
+		p.problems = append(p.problems, fmt.Sprintf("%s: until: %v", path, err))
+		return
+	}
+	p.checkRefs(path, "until", refs)
+}
+
+func (p *dryRunPlanner) planAgent(item WorkflowItem, depth int) {
+	path := workflowPath(p.ctx.Location)
+	label := fmt.Sprintf("%s %s", path, item.Name)
+	indent := strings.Repeat("  ", depth)
+	agent := p.cfg.Agents[item.Agent]
+	fmt.Fprintf(p.out, "%s%s %s (%s)\n", indent, path, item.Name, item.Agent)
+	indent += "  "
+
+	templates := map[string]string{
+		"input.prompt":       item.Input.Prompt,
+		"input.file":         item.Input.File,
+		"output.file":        item.Output.File,
+		"agent.outputSchema": agent.OutputSchema,
+		"agent.outputFile":   agent.OutputFile,
+	}
+	fields := make([]string, 0, len(templates))
+	for field := range templates {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		refs, err := templateOutputRefs(templates[field])
+		if err != nil {
+			p.problems = append(p.problems, fmt.Sprintf("%s: %s: %v", label, field, err))
+			continue
+		}
+		p.checkRefs(label, field, refs)
+	}
+	if from := item.Input.From; from != "" && from != "input" && from != "previous" && from != "prev" {
+		p.checkRefs(label, "input.from", []string{from})
+	}
+
+	input, err := resolveInput(p.ctx, item.Input)
+	switch {
+	case err == nil:
+	case item.Input.File != "" && item.Input.Prompt == "":
+		// The file may be produced by an earlier node.
+		p.warnings = append(p.warnings, fmt.Sprintf("%s: input: %v", label, err))
+		input = fmt.Sprintf("<contents of %s>", item.Input.File)
+	default:
+		p.problems = append(p.problems, fmt.Sprintf("%s: input: %v", label, err))
+		input = "<unrendered input>"
+	}
+
+	if len(agent.Env) > 0 {
+		keys := make([]string, 0, len(agent.Env))
+		for key := range agent.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(p.out, "%senv %s=%s\n", indent, key, shellQuote(agent.Env[key].display(key)))
+		}
+	}
+	if agent.Type == "replay" {
+		fmt.Fprintf(p.out, "%sreplay from %s\n", indent, agent.Run)
+	} else {
+		if startsNewCodexSession(p.ctx, agent, item) {
+			p.warnings = append(p.warnings, fmt.Sprintf("%s: session.resume: no earlier %s session, a new one starts", label, item.Agent))
+		}
+		command, args, err := buildAgentCommand(p.ctx, agent, item, input)
+		if err != nil {
+			p.problems = append(p.problems, fmt.Sprintf("%s: command: %v", label, err))
+		} else {
+			fmt.Fprintf(p.out, "%s$ %s\n", indent, quoteArgs(p.ctx.Redactor.maskAll(append([]string{command}, args...))))
+		}
+		planSession(p.ctx, item.Agent, agent)
+	}
+
+	placeholder := fmt.Sprintf("<output of %s>", item.Name)
+	if item.Output.ToNext {
+		p.ctx.LastOutput = placeholder
+		p.ctx.Outputs["__previous__"] = placeholder
+		p.ctx.Outputs[item.Name] = placeholder
+		p.produced[item.Name] = true
+		fmt.Fprintf(p.out, "%s-> next node\n", indent)
+	}
+	if item.Output.File != "" {
+		target, err := p.ctx.render(item.Output.File)
+		if err != nil {
+			p.problems = append(p.problems, fmt.Sprintf("%s: output.file: %v", label, err))
+		} else {
+			fmt.Fprintf(p.out, "%s-> file %s\n", indent, target)
+		}
+	}
+	if item.Output.Stdout {
+		fmt.Fprintf(p.out, "%s-> stdout\n", indent)
+	}
+}
+
+func (p *dryRunPlanner) checkRefs(label, field string, refs []string) {
+	for _, ref := range refs {
+		name := strings.TrimSuffix(ref, "_json")
+		switch {
+		case strings.HasPrefix(ref, "__previous"), p.produced[name]:
+		case p.later[name]:
+			p.warnings = append(p.warnings, fmt.Sprintf("%s: %s references outputs.%s, which is empty on the first iteration", label, field, ref))
+		default:
+			p.warnings = append(p.warnings, fmt.Sprintf("%s: %s references outputs.%s, which no earlier node produces", label, field, ref))
+		}
+	}
+}
+
+// producedNames lists nodes whose output is routed to outputs (toNext).
+func producedNames(items []WorkflowItem) []string {
+	names := []string{}
+	for _, item := range items {
+		switch item.Type {
+		case "agent":
+			if item.Output.ToNext && item.Name != "" {
+				names = append(names, item.Name)
+			}
+		case "loop":
+			names = append(names, producedNames(item.Body)...)
+		}
+	}
+	return names
+}
+
+// templateOutputRefs returns the keys a template reads from .outputs, via
+// .outputs.key or index .outputs "key".
+func templateOutputRefs(input string) ([]string, error) {
+	if input == "" {
+		return nil, nil
+	}
+	tpl, err := template.New("moleman").Funcs(templateFuncs(nil)).Parse(input)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	refs := []string{}
+	var visit func(node parse.Node)
+	visit = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				visit(child)
+			}
+		case *parse.ActionNode:
+			visit(n.Pipe)
+		case *parse.IfNode:
+			visit(n.Pipe)
+			visit(n.List)
+			visit(n.ElseList)
+		case *parse.RangeNode:
+			visit(n.Pipe)
+			visit(n.List)
+			visit(n.ElseList)
+		case *parse.WithNode:
+			visit(n.Pipe)
+			visit(n.List)
+			visit(n.ElseList)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				visit(cmd)
+			}
+		case *parse.CommandNode:
+			if len(n.Args) >= 3 {
+				ident, isIdent := n.Args[0].(*parse.IdentifierNode)
+				field, isField := n.Args[1].(*parse.FieldNode)
+				key, isString := n.Args[2].(*parse.StringNode)
+				if isIdent && ident.Ident == "index" && isField && len(field.Ident) == 1 && field.Ident[0] == "outputs" && isString {
+					refs = append(refs, key.Text)
+				}
+			}
+			for _, arg := range n.Args {
+				visit(arg)
+			}
+		case *parse.FieldNode:
+			if len(n.Ident) >= 2 && n.Ident[0] == "outputs" {
+				refs = append(refs, n.Ident[1])
+			}
+		}
+	}
+	visit(tpl.Tree.Root)
+	return refs, nil
+}
+
+// conditionOutputRefs returns the keys an until expression reads from
+// outputs, via outputs.key or outputs["key"].
+func conditionOutputRefs(expr string) ([]string, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "{{") && strings.HasSuffix(expr, "}}") {
+		expr = strings.TrimSpace(strings.TrimPrefix(strings.TrimSuffix(expr, "}}"), "{{"))
+	}
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("parse condition: %w", err)
+	}
+	refs := []string{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.SelectorExpr:
+			if ident, ok := e.X.(*ast.Ident); ok && ident.Name == "outputs" {
+				refs = append(refs, e.Sel.Name)
+			}
+		case *ast.IndexExpr:
+			ident, isIdent := e.X.(*ast.Ident)
+			lit, isLit := e.Index.(*ast.BasicLit)
+			if isIdent && ident.Name == "outputs" && isLit {
+				if key, err := strconv.Unquote(lit.Value); err == nil {
+					refs = append(refs, key)
+				}
+			}
+		}
+		return true
+	})
+	return refs, nil
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+func shellQuote(arg string) string {
+	if shellSafe.MatchString(arg) {
+		return arg
+	}
+	return shellEscape(arg)
+}
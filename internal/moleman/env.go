@@ -0,0 +1,171 @@
+package moleman
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvValue is an agent env entry: a literal string (which may reference
+// ${VAR} or ${VAR:-default}) or a {fromFile: path} secret reference read at
+// run time. Values from files, marked secret, or under secret-looking names
+// are masked wherever moleman records them.
+type EnvValue struct {
+	Value    string `yaml:"value,omitempty"`
+	FromFile string `yaml:"fromFile,omitempty"`
+	Secret   bool   `yaml:"secret,omitempty"`
+}
+
+func (v *EnvValue) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		v.Value = node.Value
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: env value must be a string or a mapping", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		switch key := node.Content[i]; key.Value {
+		case "value", "fromFile", "secret":
+		default:
+			return fmt.Errorf("line %d: field %s not found in env value (want value, fromFile or secret)", key.Line, key.Value)
+		}
+	}
+	type plain EnvValue
+	return node.Decode((*plain)(v))
+}
+
+func (v EnvValue) MarshalYAML() (any, error) {
+	if v.FromFile == "" && !v.Secret {
+		return v.Value, nil
+	}
+	type plain EnvValue
+	return plain(v), nil
+}
+
+func (v EnvValue) MarshalJSON() ([]byte, error) {
+	if v.FromFile == "" && !v.Secret {
+		return json.Marshal(v.Value)
+	}
+	return json.Marshal(map[string]any{"value": v.Value, "fromFile": v.FromFile, "secret": v.Secret})
+}
+
+func (v EnvValue) isSecret(key string) bool {
+	return v.Secret || v.FromFile != "" || secretEnvKey.MatchString(key)
+}
+
+// display renders the entry for explain and dry-run output without
+// resolving it.
+func (v EnvValue) display(key string) string {
+	switch {
+	case v.FromFile != "":
+		return "fromFile " + v.FromFile
+	case v.Secret && v.Value != "":
+		return "****"
+	default:
+		return maskEnvValue(key, v.Value)
+	}
+}
+
+var envRef = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnvRefs replaces ${VAR} and ${VAR:-default} with environment values;
+// $${ is a literal ${. Values of secret-looking variables are added to
+// secrets.
+func expandEnvRefs(input string, secrets *redactor) (string, error) {
+	if !strings.Contains(input, "${") {
+		return input, nil
+	}
+	var missing []string
+	expanded := envRef.ReplaceAllStringFunc(input, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		match := envRef.FindStringSubmatch(ref)
+		name, hasDefault, fallback := match[1], match[2] != "", match[3]
+		value, ok := os.LookupEnv(name)
+		if !ok || (value == "" && hasDefault) {
+			if !hasDefault {
+				missing = append(missing, name)
+				return ref
+			}
+			value = fallback
+		}
+		if secretEnvKey.MatchString(name) {
+			secrets.add(value)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable not set: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// templateEnv is the env template function: {{ env "VAR" }} fails when VAR
+// is unset, {{ env "VAR" "default" }} falls back like ${VAR:-default}.
+func templateEnv(secrets *redactor) func(string, ...string) (string, error) {
+	return func(name string, fallback ...string) (string, error) {
+		if len(fallback) > 1 {
+			return "", fmt.Errorf("env %s: takes at most one default", name)
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok || (value == "" && len(fallback) == 1) {
+			if len(fallback) == 0 {
+				return "", fmt.Errorf("environment variable not set: %s", name)
+			}
+			value = fallback[0]
+		}
+		if secretEnvKey.MatchString(name) {
+			secrets.add(value)
+		}
+		return value, nil
+	}
+}
+
+// resolveAgentEnv expands and reads an agent's env entries, registering
+// secret values.
+func resolveAgentEnv(env map[string]EnvValue, secrets *redactor) (map[string]string, error) {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	resolved := map[string]string{}
+	for _, key := range keys {
+		entry := env[key]
+		value, err := expandEnvRefs(entry.Value, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %w", key, err)
+		}
+		if entry.FromFile != "" {
+			path, err := expandEnvRefs(entry.FromFile, secrets)
+			if err != nil {
+				return nil, fmt.Errorf("env %s: %w", key, err)
+			}
+			if path == "~" || strings.HasPrefix(path, "~/") {
+				home, err := os.UserHomeDir()
+				if err != nil {
+					return nil, fmt.Errorf("env %s: %w", key, err)
+				}
+				path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("env %s: read secret: %w", key, err)
+			}
+			value = strings.TrimRight(string(raw), "\r\n")
+		}
+		if entry.isSecret(key) {
+			secrets.add(value)
+		}
+		resolved[key] = value
+	}
+	return resolved, nil
+}
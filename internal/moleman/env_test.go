@@ -0,0 +1,140 @@
+package moleman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnvRefs(t *testing.T) {
+	t.Setenv("MOLEMAN_TEST_MODE", "review")
+	t.Setenv("MOLEMAN_TEST_EMPTY", "")
+	got, err := expandEnvRefs("mode=${MOLEMAN_TEST_MODE} level=${MOLEMAN_TEST_UNSET:-low} empty=${MOLEMAN_TEST_EMPTY:-x} $${HOME}", nil)
+	if err != nil {
+		t.Fatalf("expand: %v", err)
+	}
+	if got != "mode=review level=low empty=x ${HOME}" {
+		t.Fatalf("unexpected expansion: %q", got)
+	}
+	if _, err := expandEnvRefs("${MOLEMAN_TEST_UNSET}", nil); err == nil || !strings.Contains(err.Error(), "MOLEMAN_TEST_UNSET") {
+		t.Fatalf("expected unset variable error, got %v", err)
+	}
+}
+
+func TestRenderLeavesEnvRefsInPrompts(t *testing.T) {
+	t.Setenv("MOLEMAN_TEST_MODE", "review")
+	ctx := &RunContext{Outputs: map[string]any{}, Budget: &Budget{}, Redactor: &redactor{}}
+	got, err := ctx.render(`echo "${HOME}" "${1}" ${MOLEMAN_TEST_UNSET}`)
+	if err != nil || got != `echo "${HOME}" "${1}" ${MOLEMAN_TEST_UNSET}` {
+		t.Fatalf("expected prompt to be kept, got %q (%v)", got, err)
+	}
+	got, err = ctx.renderAgentField("schemas/${MOLEMAN_TEST_MODE}.json")
+	if err != nil || got != "schemas/review.json" {
+		t.Fatalf("expected agent field to be expanded, got %q (%v)", got, err)
+	}
+}
+
+func TestRenderEnvFunction(t *testing.T) {
+	t.Setenv("MOLEMAN_TEST_MODE", "review")
+	t.Setenv("MOLEMAN_TEST_TOKEN", "tok-abcdef123")
+	ctx := &RunContext{Outputs: map[string]any{}, Budget: &Budget{}, Redactor: &redactor{}}
+	got, err := ctx.render(`{{ env "MOLEMAN_TEST_MODE" }} {{ env "MOLEMAN_TEST_UNSET" "low" }} {{ env "MOLEMAN_TEST_TOKEN" }}`)
+	if err != nil || got != "review low tok-abcdef123" {
+		t.Fatalf("unexpected render: %q (%v)", got, err)
+	}
+	if masked := ctx.Redactor.mask(got); masked != "review low ****" {
+		t.Fatalf("expected env secrets to be masked, got %q", masked)
+	}
+	if _, err := ctx.render(`{{ env "MOLEMAN_TEST_UNSET" }}`); err == nil || !strings.Contains(err.Error(), "environment variable not set: MOLEMAN_TEST_UNSET") {
+		t.Fatalf("expected unset variable error, got %v", err)
+	}
+}
+
+func TestResolveAgentEnvReadsSecretFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	secretPath := filepath.Join(tempDir, "token")
+	writeFile(t, secretPath, "s3cr3t-value\n")
+	t.Setenv("MOLEMAN_TEST_MODE", "review")
+
+	secrets := &redactor{}
+	env, err := resolveAgentEnv(map[string]EnvValue{
+		"API_TOKEN": {FromFile: secretPath},
+		"MODE":      {Value: "${MOLEMAN_TEST_MODE}"},
+	}, secrets)
+	if err != nil {
+		t.Fatalf("resolve env: %v", err)
+	}
+	if env["API_TOKEN"] != "s3cr3t-value" || env["MODE"] != "review" {
+		t.Fatalf("unexpected env: %#v", env)
+	}
+	if got := secrets.mask("token is s3cr3t-value, mode review"); got != "token is ****, mode review" {
+		t.Fatalf("unexpected mask: %q", got)
+	}
+}
+
+func TestRunMasksSecretsInArtifacts(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("MOLEMAN_TEST_TOKEN", "tok-123456")
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	config := `version: 1
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+    args: ["--token=${MOLEMAN_TEST_TOKEN}"]
+    capture: [stdout]
+
+workflow:
+  - type: agent
+    name: first
+    agent: echo
+    input:
+      prompt: "hello"
+    output:
+      file: "%s/out.txt"
+`
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(config, tempDir)), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	result, err := Run(cfg, configPath, RunOptions{Workdir: tempDir})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	for _, path := range []string{
+		filepath.Join(result.RunDir, "summary.json"),
+		filepath.Join(result.RunDir, "nodes", "first", "meta.json"),
+	} {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		if strings.Contains(string(raw), "tok-123456") {
+			t.Fatalf("%s leaks the secret:\n%s", filepath.Base(path), raw)
+		}
+	}
+	meta, _ := os.ReadFile(filepath.Join(result.RunDir, "nodes", "first", "meta.json"))
+	if !strings.Contains(string(meta), "--token=****") {
+		t.Fatalf("expected masked command in meta.json:\n%s", meta)
+	}
+}
+
+func TestValidateConfigRejectsValueAndFromFile(t *testing.T) {
+	cfg := &Config{
+		Version: 1,
+		Agents: map[string]AgentConfig{
+			"echo": {Type: "generic", Command: "printf", Env: map[string]EnvValue{"API_KEY": {Value: "x", FromFile: "~/.key"}}},
+		},
+		Workflow: []WorkflowItem{{Type: "agent", Name: "first", Agent: "echo", Input: InputSpec{Prompt: "hi"}, Output: OutputSpec{ToNext: true}}},
+	}
+	err := ValidateConfig(cfg)
+	if err == nil || !strings.Contains(err.Error(), "agents.echo.env.API_KEY sets both value and fromFile") {
+		t.Fatalf("expected env error, got %v", err)
+	}
+}
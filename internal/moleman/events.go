@@ -0,0 +1,140 @@
+package moleman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is one line of events.jsonl.
+type Event struct {
+	Seq       int            `json:"seq"`
+	Time      time.Time      `json:"time"`
+	Type      string         `json:"type"`
+	RunID     string         `json:"runId"`
+	Path      string         `json:"path,omitempty"`
+	Node      string         `json:"node,omitempty"`
+	Agent     string         `json:"agent,omitempty"`
+	Iteration []int          `json:"iteration,omitempty"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// EventLog fans events out to the run's events.jsonl and any extra targets.
+// A nil *EventLog discards events, and it is safe for concurrent use since
+// stdout and stderr of an agent are streamed from separate goroutines.
+type EventLog struct {
+	mu       sync.Mutex
+	runID    string
+	seq      int
+	writers  []io.Writer
+	closers  []io.Closer
+	listener func(Event)
+}
+
+func newEventLog(runID, runDir, extraTarget string, listener func(Event)) (*EventLog, error) {
+	log := &EventLog{runID: runID, listener: listener}
+	file, err := os.Create(filepath.Join(runDir, "events.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("create events.jsonl: %w", err)
+	}
+	log.writers = append(log.writers, file)
+	log.closers = append(log.closers, file)
+	if extraTarget != "" {
+		target, err := openEventTarget(extraTarget)
+		if err != nil {
+			log.Close()
+			return nil, err
+		}
+		log.writers = append(log.writers, target)
+		log.closers = append(log.closers, target)
+	}
+	return log, nil
+}
+
+// openEventTarget opens `fd:N` as an inherited file descriptor, otherwise the
+// value is a file path that is created or truncated.
+func openEventTarget(target string) (io.WriteCloser, error) {
+	if rest, ok := strings.CutPrefix(target, "fd:"); ok {
+		fd, err := strconv.Atoi(rest)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid events file descriptor: %s", target)
+		}
+		return os.NewFile(uintptr(fd), "events"), nil
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return nil, fmt.Errorf("open events target: %w", err)
+	}
+	return file, nil
+}
+
+func (l *EventLog) Emit(event Event) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	event.Seq = l.seq
+	event.Time = time.Now()
+	event.RunID = l.runID
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	raw = append(raw, '\n')
+	for _, writer := range l.writers {
+		_, _ = writer.Write(raw)
+	}
+	if l.listener != nil {
+		l.listener(event)
+	}
+}
+
+func (l *EventLog) Close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, closer := range l.closers {
+		_ = closer.Close()
+	}
+	l.writers = nil
+	l.closers = nil
+}
+
+// emit records an event scoped to the current workflow position and loop
+// iteration.
+func (ctx *RunContext) emit(eventType, node, agent string, data map[string]any) {
+	if masked, ok := ctx.Redactor.maskValue(data).(map[string]any); ok {
+		data = masked
+	}
+	event := Event{Type: eventType, Path: workflowPath(ctx.Location), Node: node, Agent: agent, Data: data}
+	if len(ctx.Iteration) > 0 {
+		event.Iteration = append([]int(nil), ctx.Iteration...)
+	}
+	ctx.Events.Emit(event)
+}
+
+// eventOutputWriter turns chunks of agent output into node.output events.
+type eventOutputWriter struct {
+	ctx    *RunContext
+	node   string
+	agent  string
+	stream string
+}
+
+func (w *eventOutputWriter) Write(p []byte) (int, error) {
+	w.ctx.emit("node.output", w.node, w.agent, map[string]any{
+		"stream": w.stream,
+		"text":   string(p),
+	})
+	return len(p), nil
+}
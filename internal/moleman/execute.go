@@ -10,41 +10,54 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
 )
 
+const terminateGracePeriod = 10 * time.Second
+
+var ErrCancelled = errors.New("run cancelled")
+
 func executeWorkflow(ctx *RunContext, cfg *Config, items []WorkflowItem) error {
-	for _, item := range items {
-		switch item.Type {
-		case "agent":
-			if err := executeAgentNode(ctx, cfg, item); err != nil {
-				return err
-			}
-		case "loop":
-			if err := executeLoop(ctx, cfg, item); err != nil {
-				return err
-			}
-		default:
-			return fmt.Errorf("unknown workflow type: %s", item.Type)
+	for idx, item := range items {
+		if err := ctx.stopErr(); err != nil {
+			return err
+		}
+		ctx.Location = append(ctx.Location, idx)
+		err := executeItem(ctx, cfg, item)
+		ctx.Location = ctx.Location[:len(ctx.Location)-1]
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+func executeItem(ctx *RunContext, cfg *Config, item WorkflowItem) error {
+	switch item.Type {
+	case "agent":
+		return executeAgentNode(ctx, cfg, item)
+	case "loop":
+		return executeLoop(ctx, cfg, item)
+	default:
+		return fmt.Errorf("unknown workflow type: %s", item.Type)
+	}
+}
+
 func executeLoop(ctx *RunContext, cfg *Config, item WorkflowItem) error {
 	for i := 0; i < item.MaxIters; i++ {
+		if err := ctx.Budget.startIteration(); err != nil {
+			return err
+		}
 		if ctx.Verbose {
 			log.Debugf("loop iteration %d/%d", i+1, item.MaxIters)
 		}
-		if err := executeWorkflow(ctx, cfg, item.Body); err != nil {
-			return err
-		}
-		cond, err := EvalCondition(item.Until, ctx.TemplateData())
+		cond, err := executeLoopIteration(ctx, cfg, item, i+1)
 		if err != nil {
-			return fmt.Errorf("loop condition: %w", err)
+			return err
 		}
 		if cond {
 			log.Info("loop condition met", "iteration", i+1, "max", item.MaxIters)
@@ -54,6 +67,37 @@ func executeLoop(ctx *RunContext, cfg *Config, item WorkflowItem) error {
 	return fmt.Errorf("loop exhausted without meeting condition")
 }
 
+// executeLoopIteration runs the loop body once and reports whether the until
+// condition is met. Nodes and events inside it carry the iteration index.
+func executeLoopIteration(ctx *RunContext, cfg *Config, item WorkflowItem, iteration int) (bool, error) {
+	ctx.Iteration = append(ctx.Iteration, iteration)
+	defer func() {
+		ctx.Iteration = ctx.Iteration[:len(ctx.Iteration)-1]
+	}()
+	ctx.emit("loop.iteration", "", "", map[string]any{
+		"iteration": iteration,
+		"maxIters":  item.MaxIters,
+	})
+
+	if err := executeWorkflow(ctx, cfg, item.Body); err != nil {
+		return false, err
+	}
+
+	cond, err := EvalCondition(item.Until, ctx.TemplateData())
+	evaluated := map[string]any{
+		"expr":  item.Until,
+		"value": cond,
+	}
+	if err != nil {
+		evaluated["error"] = err.Error()
+	}
+	ctx.emit("condition.evaluated", "", "", evaluated)
+	if err != nil {
+		return false, fmt.Errorf("loop condition: %w", err)
+	}
+	return cond, nil
+}
+
 func executeAgentNode(ctx *RunContext, cfg *Config, item WorkflowItem) error {
 	agent, ok := cfg.Agents[item.Agent]
 	if !ok {
@@ -65,57 +109,125 @@ func executeAgentNode(ctx *RunContext, cfg *Config, item WorkflowItem) error {
 		return err
 	}
 
-	command, args, err := buildAgentCommand(ctx, agent, item, input)
-	if err != nil {
-		return err
+	replay := ctx.replayFor(item.Agent)
+	command, args := "", []string{}
+	if replay == nil && ctx.Mocks == nil {
+		if startsNewCodexSession(ctx, agent, item) {
+			log.Warn("no codex session to resume yet; starting a new one", "node", item.Name, "agent", item.Agent)
+		}
+		command, args, err = buildAgentCommand(ctx, agent, item, input)
+		if err != nil {
+			return err
+		}
 	}
 
-	stepDir, err := nodeRunDir(ctx.RunDir, item.Name)
+	stepDir, err := nodeRunDir(ctx.RunDir, item.Name, ctx.Iteration)
 	if err != nil {
 		return err
 	}
 
-	stdoutBuf, stderrBuf, exitCode, duration, err := runCommand(ctx, item.Name, item.Agent, command, args, agent, stepDir, input)
+	if err := ctx.Budget.startAgent(item.Name); err != nil {
+		return err
+	}
+	startData := map[string]any{
+		"command": ctx.Redactor.mask(command),
+		"args":    ctx.Redactor.maskAll(args),
+		"dir":     runRelativePath(ctx.RunDir, stepDir),
+	}
+	switch {
+	case ctx.Mocks != nil:
+		startData["mock"] = true
+	case replay != nil:
+		startData["replay"] = replay.runID
+	}
+	ctx.emit("node.started", item.Name, item.Agent, startData)
+	var out *commandOutput
+	switch {
+	case ctx.Mocks != nil:
+		out, err = mockCommand(ctx, item.Name, item.Agent, agent, stepDir, input)
+	case replay != nil:
+		out, err = replayCommand(ctx, replay, item.Name, item.Agent, agent, stepDir)
+	default:
+		out, err = runCommand(ctx, item.Name, item.Agent, command, args, agent, stepDir, input)
+	}
 	if err != nil {
 		return err
 	}
-
-	if err := handleOutput(ctx, item, stdoutBuf.Bytes()); err != nil {
+	result := out.Result
+	if len(ctx.Iteration) > 0 {
+		result.Iteration = append([]int(nil), ctx.Iteration...)
+	}
+	ctx.Budget.addUsage(result.Usage)
+	if err := ctx.stopErr(); err != nil {
+		result.Status = "cancelled"
+		if errors.Is(err, ErrBudgetExceeded) {
+			result.Status = "budget-exceeded"
+		}
+		recordNodeResult(ctx, stepDir, result)
+		log.Warn("node interrupted", "name", item.Name, "agent", item.Agent, "reason", err)
 		return err
 	}
 
-	if agent.Type == "claude" {
-		updateClaudeSession(ctx, stdoutBuf.Bytes())
+	output := out.Stdout.Bytes()
+	if agent.Type == "codex" {
+		output = codexOutput(agent, output)
+	}
+	if result.ExitCode == 0 && item.Output.Type == "json" && parseJSONOutput(output) == nil {
+		result.Status = "failed"
+		recordNodeResult(ctx, stepDir, result)
+		return fmt.Errorf("node failed: %s output is not valid JSON. see %s", item.Name, filepath.Join(stepDir, "stdout.log"))
 	}
 
-	ctx.NodeResults = append(ctx.NodeResults, NodeResult{
-		Name:     item.Name,
-		Agent:    item.Agent,
-		ExitCode: exitCode,
-		Duration: duration,
-		Command:  strings.Join(append([]string{command}, args...), " "),
-	})
+	outputFile, err := handleOutput(ctx, item, output)
+	if err != nil {
+		return err
+	}
+	result.OutputFile = outputFile
+
+	switch agent.Type {
+	case "claude":
+		updateClaudeSession(ctx, out.Stdout.Bytes())
+	case "codex":
+		updateCodexSession(ctx, item.Agent, out.Stdout.Bytes())
+	}
 
-	if exitCode != 0 {
-		stderrSummary := summarizeStderr(stderrBuf)
+	if result.ExitCode != 0 {
+		result.Status = "failed"
+		recordNodeResult(ctx, stepDir, result)
+		stderrSummary := ctx.Redactor.mask(summarizeStderr(out.Stderr))
 		stderrPath := filepath.Join(stepDir, "stderr.log")
 		if stderrSummary != "" {
-			return fmt.Errorf("node failed: %s (exit %d). stderr: %s (see %s)", item.Name, exitCode, stderrSummary, stderrPath)
+			return fmt.Errorf("node failed: %s (exit %d). stderr: %s (see %s)", item.Name, result.ExitCode, stderrSummary, stderrPath)
 		}
-		return fmt.Errorf("node failed: %s (exit %d). see %s", item.Name, exitCode, stderrPath)
+		return fmt.Errorf("node failed: %s (exit %d). see %s", item.Name, result.ExitCode, stderrPath)
 	}
 
-	log.Info("node done", "name", item.Name, "agent", item.Agent, "exit", exitCode, "duration", duration)
-	return nil
+	result.Status = "success"
+	recordNodeResult(ctx, stepDir, result)
+	log.Info("node done", "name", item.Name, "agent", item.Agent, "exit", result.ExitCode, "duration", time.Duration(result.DurationMs)*time.Millisecond)
+	return ctx.Budget.checkCost(item.Name)
+}
+
+func recordNodeResult(ctx *RunContext, stepDir string, result NodeResult) {
+	ctx.NodeResults = append(ctx.NodeResults, result)
+	ctx.emit("node.finished", result.Name, result.Agent, map[string]any{
+		"status":     result.Status,
+		"exitCode":   result.ExitCode,
+		"durationMs": result.DurationMs,
+		"usage":      result.Usage,
+		"outputFile": result.OutputFile,
+	})
+	if err := writeMeta(stepDir, result, ctx.Redactor); err != nil {
+		log.Warn("write node meta", "name", result.Name, "err", err)
+	}
 }
 
 func resolveInput(ctx *RunContext, input InputSpec) (string, error) {
-	data := ctx.TemplateData()
 	if input.Prompt != "" {
-		return RenderTemplate(input.Prompt, data)
+		return ctx.render(input.Prompt)
 	}
 	if input.File != "" {
-		path, err := RenderTemplate(input.File, data)
+		path, err := ctx.render(input.File)
 		if err != nil {
 			return "", err
 		}
@@ -143,7 +255,17 @@ func resolveInput(ctx *RunContext, input InputSpec) (string, error) {
 }
 
 func buildAgentCommand(ctx *RunContext, agent AgentConfig, item WorkflowItem, input string) (string, []string, error) {
-	command := agent.Command
+	command, err := expandEnvRefs(agent.Command, ctx.Redactor)
+	if err != nil {
+		return "", nil, fmt.Errorf("command: %w", err)
+	}
+	agentArgs := make([]string, len(agent.Args))
+	for idx, arg := range agent.Args {
+		agentArgs[idx], err = expandEnvRefs(arg, ctx.Redactor)
+		if err != nil {
+			return "", nil, fmt.Errorf("args: %w", err)
+		}
+	}
 	if command == "" {
 		switch agent.Type {
 		case "codex":
@@ -157,11 +279,10 @@ func buildAgentCommand(ctx *RunContext, agent AgentConfig, item WorkflowItem, in
 
 	session := effectiveSession(agent.Session, item.Session)
 	args := []string{}
-	templateData := ctx.TemplateData()
 	modelArgs := buildModelArgs(agent)
 	outputSchema := agent.OutputSchema
 	if outputSchema != "" {
-		resolved, err := RenderTemplate(outputSchema, templateData)
+		resolved, err := ctx.renderAgentField(outputSchema)
 		if err != nil {
 			return "", nil, err
 		}
@@ -169,7 +290,7 @@ func buildAgentCommand(ctx *RunContext, agent AgentConfig, item WorkflowItem, in
 	}
 	outputFile := agent.OutputFile
 	if outputFile != "" {
-		resolved, err := RenderTemplate(outputFile, templateData)
+		resolved, err := ctx.renderAgentField(outputFile)
 		if err != nil {
 			return "", nil, err
 		}
@@ -178,29 +299,29 @@ func buildAgentCommand(ctx *RunContext, agent AgentConfig, item WorkflowItem, in
 
 	switch agent.Type {
 	case "codex":
-		resumeLast := session.Resume == "last"
-		if resumeLast && (outputSchema != "" || outputFile != "") {
-			log.Warn("codex resume disabled for output schema/file", "node", item.Name, "agent", item.Agent)
-			resumeLast = false
-		}
-		if resumeLast {
-			args = append(args, "exec", "resume", "--last")
-		} else {
-			args = append(args, "exec")
-		}
+		// Exec options go before the resume subcommand. --json events carry
+		// the session ID, which resume takes instead of --last so that only a
+		// session this agent started in this run is resumed.
+		args = append(args, "exec")
 		args = append(args, modelArgs...)
-		args = append(args, agent.Args...)
+		args = append(args, agentArgs...)
+		if !isOneOf("--json", agentArgs) {
+			args = append(args, "--json")
+		}
 		if outputSchema != "" {
 			args = append(args, "--output-schema", outputSchema)
 		}
 		if outputFile != "" {
 			args = append(args, "--output-last-message", outputFile)
 		}
+		if sessionID := ctx.CodexSessions[item.Agent]; session.Resume == "last" && sessionID != "" {
+			args = append(args, "resume", sessionID)
+		}
 		args = append(args, input)
 	case "claude":
 		args = append(args, "-p", input)
 		args = append(args, modelArgs...)
-		args = append(args, agent.Args...)
+		args = append(args, agentArgs...)
 		if session.Resume == "last" {
 			sessionID := ctx.Sessions["claude"]
 			if sessionID == "" {
@@ -212,7 +333,7 @@ func buildAgentCommand(ctx *RunContext, agent AgentConfig, item WorkflowItem, in
 		if command == "" {
 			return "", nil, fmt.Errorf("generic agent requires command")
 		}
-		args = append(args, agent.Args...)
+		args = append(args, agentArgs...)
 		if input != "" {
 			args = append(args, input)
 		}
@@ -251,19 +372,35 @@ func effectiveSession(agentSession *SessionSpec, nodeSession SessionSpec) Sessio
 	return SessionSpec{Resume: "new"}
 }
 
-func runCommand(ctx *RunContext, nodeName, agentName, command string, args []string, agent AgentConfig, stepDir string, input string) (*bytes.Buffer, *bytes.Buffer, int, string, error) {
-	log.Info("node start", "command", command, "args", strings.Join(args, " "))
+// startsNewCodexSession reports whether a codex node asks to resume but its
+// agent has no session in this run yet.
+func startsNewCodexSession(ctx *RunContext, agent AgentConfig, item WorkflowItem) bool {
+	return agent.Type == "codex" && effectiveSession(agent.Session, item.Session).Resume == "last" && ctx.CodexSessions[item.Agent] == ""
+}
+
+type commandOutput struct {
+	Stdout *bytes.Buffer
+	Stderr *bytes.Buffer
+	Result NodeResult
+}
+
+func runCommand(ctx *RunContext, nodeName, agentName, command string, args []string, agent AgentConfig, stepDir string, input string) (*commandOutput, error) {
+	log.Info("node start", "command", ctx.Redactor.mask(command), "args", ctx.Redactor.mask(strings.Join(args, " ")))
+	env, err := resolveAgentEnv(agent.Env, ctx.Redactor)
+	if err != nil {
+		return nil, err
+	}
 
 	var timeout time.Duration
 	if agent.Timeout != "" {
 		parsed, err := time.ParseDuration(agent.Timeout)
 		if err != nil {
-			return nil, nil, 1, "", fmt.Errorf("timeout: %w", err)
+			return nil, fmt.Errorf("timeout: %w", err)
 		}
 		timeout = parsed
 	}
 
-	ctxExec := context.Background()
+	ctxExec := ctx.Context
 	if timeout > 0 {
 		var cancel context.CancelFunc
 		ctxExec, cancel = context.WithTimeout(ctxExec, timeout)
@@ -272,7 +409,8 @@ func runCommand(ctx *RunContext, nodeName, agentName, command string, args []str
 
 	cmd := exec.CommandContext(ctxExec, command, args...)
 	cmd.Dir = ctx.Workdir
-	cmd.Env = buildEnv(agent.Env)
+	reap := startInProcessGroup(cmd, terminateGracePeriod)
+	cmd.Env = buildEnv(env)
 
 	if input != "" && agent.Type == "claude" && !strings.Contains(strings.Join(args, " "), "-p") {
 		cmd.Stdin = strings.NewReader(input)
@@ -282,12 +420,12 @@ func runCommand(ctx *RunContext, nodeName, agentName, command string, args []str
 	stderrPath := filepath.Join(stepDir, "stderr.log")
 	stdoutFile, err := os.Create(stdoutPath)
 	if err != nil {
-		return nil, nil, 1, "", fmt.Errorf("create stdout log: %w", err)
+		return nil, fmt.Errorf("create stdout log: %w", err)
 	}
 	defer stdoutFile.Close()
 	stderrFile, err := os.Create(stderrPath)
 	if err != nil {
-		return nil, nil, 1, "", fmt.Errorf("create stderr log: %w", err)
+		return nil, fmt.Errorf("create stderr log: %w", err)
 	}
 	defer stderrFile.Close()
 
@@ -305,55 +443,144 @@ func runCommand(ctx *RunContext, nodeName, agentName, command string, args []str
 	stdoutTracker := &outputTracker{}
 	stderrTracker := &outputTracker{}
 
-	cmd.Stdout = writerFor(stdoutFile, &stdoutBuf, captureStdout, pickWriter(printStdout, os.Stdout), stdoutTracker)
-	cmd.Stderr = writerFor(stderrFile, &stderrBuf, captureStderr, pickWriter(printStderr, os.Stderr), stderrTracker)
+	stdoutEvents := &eventOutputWriter{ctx: ctx, node: nodeName, agent: agentName, stream: "stdout"}
+	stderrEvents := &eventOutputWriter{ctx: ctx, node: nodeName, agent: agentName, stream: "stderr"}
+	stdoutOut := artifactWriter(stdoutFile, pickWriter(printStdout, ctx.stdout()), stdoutTracker, stdoutEvents)
+	// Codex events stay raw in stdout.log; the console, TUI and event
+	// stream get the agent messages.
+	var stdoutConsole *codexConsoleWriter
+	if rendersCodexEvents(agent) {
+		stdoutConsole = &codexConsoleWriter{out: artifactWriter(nil, pickWriter(printStdout, ctx.stdout()), stdoutTracker, stdoutEvents)}
+		stdoutOut = io.MultiWriter(stdoutFile, stdoutConsole)
+	}
+	stdoutRedact := &redactWriter{redactor: ctx.Redactor, out: stdoutOut}
+	stderrRedact := &redactWriter{redactor: ctx.Redactor, out: artifactWriter(stderrFile, pickWriter(printStderr, ctx.stderr()), stderrTracker, stderrEvents)}
+	cmd.Stdout = captureWriter(stdoutRedact, &stdoutBuf, captureStdout)
+	cmd.Stderr = captureWriter(stderrRedact, &stderrBuf, captureStderr)
 
 	start := time.Now()
 	runErr := cmd.Run()
-	duration := time.Since(start).String()
+	reap()
+	duration := time.Since(start)
+	_ = stdoutRedact.Flush()
+	_ = stderrRedact.Flush()
+	if stdoutConsole != nil {
+		_ = stdoutConsole.Flush()
+	}
 
 	exitCode := 0
 	if runErr != nil {
 		if errors.Is(runErr, exec.ErrNotFound) {
-			return &stdoutBuf, &stderrBuf, 127, duration, fmt.Errorf("command not found: %s", command)
+			return nil, fmt.Errorf("command not found: %s", command)
 		}
 		exitCode = exitCodeFromErr(runErr)
 	}
 
-	if ctxExec.Err() == context.DeadlineExceeded {
+	switch ctxExec.Err() {
+	case context.DeadlineExceeded:
 		exitCode = 124
+	case context.Canceled:
+		exitCode = 130
 	}
 
 	if printStdout && stdoutTracker.wrote {
-		ensureTrailingNewline(os.Stdout, stdoutTracker)
+		ensureTrailingNewline(ctx.stdout(), stdoutTracker)
 	}
 	if printStderr && stderrTracker.wrote {
-		ensureTrailingNewline(os.Stderr, stderrTracker)
+		ensureTrailingNewline(ctx.stderr(), stderrTracker)
 	}
 
-	meta := NodeResult{
-		Name:     nodeName,
-		Agent:    agentName,
-		ExitCode: exitCode,
-		Duration: duration,
-		Command:  strings.Join(append([]string{command}, args...), " "),
+	return &commandOutput{
+		Stdout: &stdoutBuf,
+		Stderr: &stderrBuf,
+		Result: NodeResult{
+			Name:       nodeName,
+			Agent:      agentName,
+			ExitCode:   exitCode,
+			StartedAt:  start,
+			DurationMs: duration.Milliseconds(),
+			Command:    ctx.Redactor.mask(strings.Join(append([]string{command}, args...), " ")),
+			Usage:      parseUsageFromLogs(agent.Type, stdoutPath, stderrPath),
+			StdoutLog:  runRelativePath(ctx.RunDir, stdoutPath),
+			StderrLog:  runRelativePath(ctx.RunDir, stderrPath),
+		},
+	}, nil
+}
+
+// cannedCommand stands in for runCommand when a node's output is replayed or
+// mocked: it writes the given output to the node logs, streams it as events
+// and prints it the way a live run would.
+func cannedCommand(ctx *RunContext, nodeName, agentName string, agent AgentConfig, stepDir, command string, stdout, stderr []byte, exitCode int) (*commandOutput, error) {
+	start := time.Now()
+	stdoutPath := filepath.Join(stepDir, "stdout.log")
+	stderrPath := filepath.Join(stepDir, "stderr.log")
+	maskedStdout := []byte(ctx.Redactor.mask(string(stdout)))
+	maskedStderr := []byte(ctx.Redactor.mask(string(stderr)))
+	if err := os.WriteFile(stdoutPath, maskedStdout, 0o644); err != nil {
+		return nil, fmt.Errorf("write stdout log: %w", err)
 	}
-	if err := writeMeta(stepDir, meta, stdoutPath, stderrPath); err != nil {
-		return &stdoutBuf, &stderrBuf, exitCode, duration, err
+	if err := os.WriteFile(stderrPath, maskedStderr, 0o644); err != nil {
+		return nil, fmt.Errorf("write stderr log: %w", err)
 	}
 
-	return &stdoutBuf, &stderrBuf, exitCode, duration, nil
+	printStdout := shouldPrint(agent.Print, "stdout") || ctx.Verbose
+	printStderr := shouldPrint(agent.Print, "stderr") || ctx.Verbose
+	consoleStdout := maskedStdout
+	if rendersCodexEvents(agent) {
+		consoleStdout = renderCodexEvents(maskedStdout)
+	}
+	cannedStream(ctx, nodeName, agentName, "stdout", consoleStdout, pickWriter(printStdout, ctx.stdout()))
+	cannedStream(ctx, nodeName, agentName, "stderr", maskedStderr, pickWriter(printStderr, ctx.stderr()))
+
+	var stdoutBuf bytes.Buffer
+	if shouldCapture(agent.Capture, "stdout") {
+		stdoutBuf.Write(stdout)
+	}
+	var stderrBuf bytes.Buffer
+	if shouldCapture(agent.Capture, "stderr") {
+		stderrBuf.Write(stderr)
+	}
+	return &commandOutput{
+		Stdout: &stdoutBuf,
+		Stderr: &stderrBuf,
+		Result: NodeResult{
+			Name:       nodeName,
+			Agent:      agentName,
+			ExitCode:   exitCode,
+			StartedAt:  start,
+			DurationMs: time.Since(start).Milliseconds(),
+			Command:    ctx.Redactor.mask(command),
+			StdoutLog:  runRelativePath(ctx.RunDir, stdoutPath),
+			StderrLog:  runRelativePath(ctx.RunDir, stderrPath),
+		},
+	}, nil
+}
+
+func cannedStream(ctx *RunContext, nodeName, agentName, stream string, data []byte, printTo io.Writer) {
+	if len(data) == 0 {
+		return
+	}
+	events := &eventOutputWriter{ctx: ctx, node: nodeName, agent: agentName, stream: stream}
+	_, _ = events.Write(data)
+	if printTo == nil {
+		return
+	}
+	_, _ = wrapPrintWriter(printTo).Write(data)
+	ensureTrailingNewline(printTo, &outputTracker{lastByte: data[len(data)-1], wrote: true})
 }
 
-func handleOutput(ctx *RunContext, item WorkflowItem, stdout []byte) error {
+// handleOutput routes the node's stdout and returns the output file path when
+// one was written.
+func handleOutput(ctx *RunContext, item WorkflowItem, stdout []byte) (string, error) {
 	output := string(stdout)
+	written := ""
 	if item.Output.ToNext {
 		ctx.LastOutput = output
 		ctx.Outputs["__previous__"] = output
 		if item.Name != "" {
 			ctx.Outputs[item.Name] = output
 		}
-		if parsed := parseJSONOutput(stdout); parsed != nil {
+		if parsed := parseJSONOutput(stdout); parsed != nil && item.Output.Type != "text" {
 			normalized := normalizeStructuredOutput(parsed)
 			ctx.Outputs["__previous_json__"] = normalized
 			if item.Name != "" {
@@ -362,26 +589,32 @@ func handleOutput(ctx *RunContext, item WorkflowItem, stdout []byte) error {
 		}
 	}
 	if item.Output.File != "" {
-		path, err := RenderTemplate(item.Output.File, ctx.TemplateData())
+		path, err := ctx.render(item.Output.File)
 		if err != nil {
-			return err
+			return "", err
+		}
+		if ctx.BeforeWrite != nil {
+			ctx.BeforeWrite(path)
 		}
 		if err := os.WriteFile(path, stdout, 0o644); err != nil {
-			return fmt.Errorf("write output file: %w", err)
+			return "", fmt.Errorf("write output file: %w", err)
 		}
+		written = path
 	}
 	if item.Output.Stdout {
-		if _, err := os.Stdout.Write([]byte("\n")); err != nil {
-			return err
+		out := ctx.stdout()
+		if _, err := out.Write([]byte("\n")); err != nil {
+			return "", err
 		}
-		if _, err := os.Stdout.Write(stdout); err != nil {
-			return err
+		printed := ctx.Redactor.mask(string(stdout))
+		if _, err := io.WriteString(out, printed); err != nil {
+			return "", err
 		}
-		if len(stdout) > 0 && stdout[len(stdout)-1] != '\n' {
-			_, _ = os.Stdout.Write([]byte("\n"))
+		if len(printed) > 0 && printed[len(printed)-1] != '\n' {
+			_, _ = out.Write([]byte("\n"))
 		}
 	}
-	return nil
+	return written, nil
 }
 
 func updateClaudeSession(ctx *RunContext, stdout []byte) {
@@ -396,6 +629,190 @@ func updateClaudeSession(ctx *RunContext, stdout []byte) {
 	}
 }
 
+// codexEvents is what moleman reads from `codex exec --json` output: the
+// session (thread) ID and the last agent message. found is false for text
+// output.
+type codexEvents struct {
+	found     bool
+	sessionID string
+	message   string
+}
+
+// codexEvent is one line of `codex exec --json` output, in the current
+// format (thread.*, turn.*, item.*, error) or the legacy one (msg.*).
+type codexEvent struct {
+	Type     string `json:"type"`
+	ThreadID string `json:"thread_id"`
+	Message  string `json:"message"`
+	Item     *struct {
+		Type     string `json:"type"`
+		ItemType string `json:"item_type"`
+		Text     string `json:"text"`
+	} `json:"item"`
+	Msg *struct {
+		Type      string `json:"type"`
+		SessionID string `json:"session_id"`
+		Message   string `json:"message"`
+	} `json:"msg"`
+}
+
+// parseCodexEvent decodes line when it is a Codex event. JSON that merely
+// has a type field, like a structured review, is not one.
+func parseCodexEvent(line []byte) (codexEvent, bool) {
+	var event codexEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		return event, false
+	}
+	if event.Msg != nil {
+		return event, event.Msg.Type != ""
+	}
+	switch {
+	case event.Type == "error",
+		strings.HasPrefix(event.Type, "thread."),
+		strings.HasPrefix(event.Type, "turn."),
+		strings.HasPrefix(event.Type, "item."):
+		return event, true
+	}
+	return event, false
+}
+
+// agentMessage returns the text of a completed agent message event.
+func (e codexEvent) agentMessage() (string, bool) {
+	switch {
+	case e.Type == "item.completed" && e.Item != nil:
+		if e.Item.Type == "agent_message" || e.Item.ItemType == "assistant_message" {
+			return e.Item.Text, true
+		}
+	case e.Msg != nil && e.Msg.Type == "agent_message":
+		return e.Msg.Message, true
+	}
+	return "", false
+}
+
+// parseCodexEvents reads the session ID (thread.started, or legacy
+// msg.session_configured) and the last agent message from codex output.
+func parseCodexEvents(stdout []byte) codexEvents {
+	var parsed codexEvents
+	for _, line := range jsonLines(stdout) {
+		event, ok := parseCodexEvent(line)
+		if !ok {
+			continue
+		}
+		parsed.found = true
+		switch {
+		case event.Type == "thread.started" && event.ThreadID != "":
+			parsed.sessionID = event.ThreadID
+		case event.Msg != nil && event.Msg.Type == "session_configured":
+			parsed.sessionID = event.Msg.SessionID
+		}
+		if message, ok := event.agentMessage(); ok {
+			parsed.message = message
+		}
+	}
+	return parsed
+}
+
+// updateCodexSession records the session ID from codex events for the
+// agent that produced them.
+func updateCodexSession(ctx *RunContext, agentName string, stdout []byte) {
+	events := parseCodexEvents(stdout)
+	if events.sessionID == "" {
+		return
+	}
+	if ctx.CodexSessions == nil {
+		ctx.CodexSessions = map[string]string{}
+	}
+	ctx.CodexSessions[agentName] = events.sessionID
+}
+
+// rendersCodexEvents reports whether moleman asked agent for --json events
+// that the agent's own args did not.
+func rendersCodexEvents(agent AgentConfig) bool {
+	return agent.Type == "codex" && !isOneOf("--json", agent.Args)
+}
+
+// codexOutput is the node output of a codex agent: its last message when
+// moleman asked for --json events, otherwise stdout as printed.
+func codexOutput(agent AgentConfig, stdout []byte) []byte {
+	if !rendersCodexEvents(agent) {
+		return stdout
+	}
+	events := parseCodexEvents(stdout)
+	if !events.found {
+		return stdout
+	}
+	return []byte(events.message)
+}
+
+// renderCodexLine turns one line of codex output into what a user reads:
+// agent messages and errors are printed, other events are dropped and
+// anything that is not an event passes through.
+func renderCodexLine(line []byte) []byte {
+	event, ok := parseCodexEvent(bytes.TrimSpace(line))
+	if !ok {
+		return line
+	}
+	text := ""
+	if message, ok := event.agentMessage(); ok {
+		text = message
+	} else if event.Type == "error" && event.Message != "" {
+		text = "error: " + event.Message
+	}
+	if text == "" {
+		return nil
+	}
+	return []byte(strings.TrimRight(text, "\n") + "\n")
+}
+
+func renderCodexEvents(data []byte) []byte {
+	var rendered []byte
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		rendered = append(rendered, renderCodexLine(data[:end])...)
+		data = data[end:]
+	}
+	return rendered
+}
+
+// codexConsoleWriter renders codex events line by line. Call Flush after
+// the last write.
+type codexConsoleWriter struct {
+	out     io.Writer
+	pending []byte
+}
+
+func (w *codexConsoleWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	end := bytes.LastIndexByte(w.pending, '\n') + 1
+	if end == 0 {
+		return len(p), nil
+	}
+	rendered := renderCodexEvents(w.pending[:end])
+	w.pending = append([]byte(nil), w.pending[end:]...)
+	if len(rendered) > 0 {
+		if _, err := w.out.Write(rendered); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *codexConsoleWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	rendered := renderCodexEvents(w.pending)
+	w.pending = nil
+	if len(rendered) == 0 {
+		return nil
+	}
+	_, err := w.out.Write(rendered)
+	return err
+}
+
 func parseJSONOutput(stdout []byte) any {
 	var value any
 	if err := json.Unmarshal(stdout, &value); err != nil {
@@ -453,37 +870,65 @@ func summarizeStderr(buf *bytes.Buffer) string {
 	return "...(truncated)...\n" + text[len(text)-maxLen:]
 }
 
-func nodeRunDir(runDir, name string) (string, error) {
+// nodeRunDir returns the artifact dir for a node execution. Nodes inside loops
+// get one subdirectory per iteration (iter-2, or iter-2-1 when nested) so later
+// iterations do not overwrite earlier logs.
+func nodeRunDir(runDir, name string, iteration []int) (string, error) {
 	if name == "" {
 		name = "node"
 	}
 	dir := filepath.Join(runDir, "nodes", name)
+	if len(iteration) > 0 {
+		dir = filepath.Join(dir, iterationLabel(iteration))
+	}
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return "", fmt.Errorf("create node dir: %w", err)
 	}
 	return dir, nil
 }
 
-func writeMeta(stepDir string, meta NodeResult, stdoutPath, stderrPath string) error {
-	raw, err := json.MarshalIndent(struct {
-		NodeResult
-		StdoutLog string `json:"stdoutLog"`
-		StderrLog string `json:"stderrLog"`
-	}{
-		NodeResult: meta,
-		StdoutLog:  stdoutPath,
-		StderrLog:  stderrPath,
-	}, "", "  ")
+func iterationLabel(iteration []int) string {
+	parts := make([]string, 0, len(iteration))
+	for _, i := range iteration {
+		parts = append(parts, strconv.Itoa(i))
+	}
+	return "iter-" + strings.Join(parts, "-")
+}
+
+func runRelativePath(runDir, path string) string {
+	rel, err := filepath.Rel(runDir, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+func writeMeta(stepDir string, meta NodeResult, redact *redactor) error {
+	raw, err := json.MarshalIndent(meta, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal meta: %w", err)
 	}
-	return os.WriteFile(filepath.Join(stepDir, "meta.json"), raw, 0o644)
+	return os.WriteFile(filepath.Join(stepDir, "meta.json"), redact.maskJSON(raw), 0o644)
+}
+
+// captureWriter tees agent output to the redacted artifact writer and, when
+// captured, unredacted to buf: later nodes need the real output.
+func captureWriter(artifacts io.Writer, buf *bytes.Buffer, capture bool) io.Writer {
+	if !capture {
+		return artifacts
+	}
+	return io.MultiWriter(buf, artifacts)
 }
 
-func writerFor(file *os.File, buf *bytes.Buffer, capture bool, printTo io.Writer, tracker *outputTracker) io.Writer {
-	writers := []io.Writer{file}
-	if capture {
-		writers = append(writers, buf)
+// artifactWriter fans output out to the node log, the event stream, the
+// console and the tracker; nil destinations are skipped.
+func artifactWriter(file io.Writer, printTo io.Writer, tracker *outputTracker, events io.Writer) io.Writer {
+	writers := []io.Writer{}
+	if file != nil {
+		writers = append(writers, file)
+	}
+	if events != nil {
+		writers = append(writers, events)
 	}
 	if printTo != nil {
 		writers = append(writers, wrapPrintWriter(printTo))
@@ -0,0 +1,203 @@
+package moleman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// AgentReport is an agent as resolved after extends merging, with the file
+// each field came from and the argv it produces for every node using it.
+type AgentReport struct {
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	Command      string            `json:"command,omitempty"`
+	Run          string            `json:"run,omitempty"`
+	Model        string            `json:"model,omitempty"`
+	Thinking     string            `json:"thinking,omitempty"`
+	Args         []string          `json:"args,omitempty"`
+	OutputSchema string            `json:"outputSchema,omitempty"`
+	OutputFile   string            `json:"outputFile,omitempty"`
+	Env          map[string]string `json:"env,omitempty"`
+	Timeout      string            `json:"timeout,omitempty"`
+	Capture      []string          `json:"capture,omitempty"`
+	Print        []string          `json:"print,omitempty"`
+	Session      string            `json:"session,omitempty"`
+	Sources      map[string]string `json:"sources"`
+	Nodes        []AgentNodeReport `json:"nodes"`
+}
+
+type AgentNodeReport struct {
+	Node  string   `json:"node"`
+	Argv  []string `json:"argv,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+var secretEnvKey = regexp.MustCompile(`(?i)(key|token|secret|passw|credential|auth)`)
+
+// maskEnvValue hides values of env vars whose names look like secrets.
+func maskEnvValue(key, value string) string {
+	if value == "" || !secretEnvKey.MatchString(key) {
+		return value
+	}
+	return "****"
+}
+
+// ResolveAgentReports describes every agent used by the workflow. Node argv
+// is rendered in workflow order with placeholder inputs, outputs and the
+// session IDs earlier nodes would leave behind.
+func ResolveAgentReports(cfg *Config) []AgentReport {
+	budget, err := newBudget(cfg.Limits, time.Now())
+	if err != nil {
+		budget = &Budget{Started: time.Now()}
+	}
+	redact, err := newRedactor(cfg.Redact)
+	if err != nil {
+		redact = &redactor{}
+	}
+	ctx := &RunContext{
+		Outputs:       map[string]any{},
+		Sessions:      map[string]string{},
+		CodexSessions: map[string]string{},
+		Params:        cfg.paramValues,
+		Redactor:      redact,
+		Budget:        budget,
+	}
+
+	nodesByAgent := map[string][]AgentNodeReport{}
+	for _, item := range flattenAgentNodes(cfg.Workflow) {
+		agent := cfg.Agents[item.Agent]
+		node := AgentNodeReport{Node: item.Name}
+		if agent.Type != "replay" {
+			command, args, err := buildAgentCommand(ctx, agent, item, fmt.Sprintf("<input of %s>", item.Name))
+			if err != nil {
+				node.Error = err.Error()
+			} else {
+				node.Argv = ctx.Redactor.maskAll(append([]string{command}, args...))
+			}
+			planSession(ctx, item.Agent, agent)
+		}
+		nodesByAgent[item.Agent] = append(nodesByAgent[item.Agent], node)
+	}
+	names := make([]string, 0, len(nodesByAgent))
+	for name := range nodesByAgent {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reports := []AgentReport{}
+	for _, name := range names {
+		agent := cfg.Agents[name]
+		sources := map[string]string{}
+		for field, source := range cfg.agentSources[name] {
+			sources[field] = source
+		}
+		command := resolveAgentCommand(agent)
+		if agent.Command == "" && command != "" {
+			sources["command"] = "default"
+		}
+		report := AgentReport{
+			Name:         name,
+			Type:         agent.Type,
+			Command:      redact.mask(command),
+			Run:          agent.Run,
+			Model:        agent.Model,
+			Thinking:     agent.Thinking,
+			Args:         redact.maskAll(agent.Args),
+			OutputSchema: agent.OutputSchema,
+			OutputFile:   agent.OutputFile,
+			Timeout:      agent.Timeout,
+			Capture:      agent.Capture,
+			Print:        agent.Print,
+			Sources:      sources,
+			Nodes:        nodesByAgent[name],
+		}
+		if agent.Session != nil {
+			report.Session = agent.Session.Resume
+		}
+		if len(agent.Env) > 0 {
+			report.Env = map[string]string{}
+			for key, value := range agent.Env {
+				report.Env[key] = value.display(key)
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// PrintAgents writes the resolved agents as text or, with format json, JSON.
+func PrintAgents(w io.Writer, cfg *Config, format string) error {
+	reports := ResolveAgentReports(cfg)
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	case "", "text":
+	default:
+		return fmt.Errorf("unknown agents format: %s (want text or json)", format)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for idx, report := range reports {
+		if idx > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "agent %s\n", report.Name)
+		row := func(field, value string) {
+			if value != "" {
+				fmt.Fprintf(tw, "  %s\t%s\t%s\n", field, report.Sources[field], value)
+			}
+		}
+		row("type", report.Type)
+		row("command", report.Command)
+		row("run", report.Run)
+		row("model", report.Model)
+		row("thinking", report.Thinking)
+		row("args", quoteArgs(report.Args))
+		row("outputSchema", report.OutputSchema)
+		row("outputFile", report.OutputFile)
+		envKeys := make([]string, 0, len(report.Env))
+		for key := range report.Env {
+			envKeys = append(envKeys, key)
+		}
+		sort.Strings(envKeys)
+		for _, key := range envKeys {
+			value := report.Env[key]
+			if value != "****" && !strings.HasPrefix(value, "fromFile ") {
+				value = shellQuote(value)
+			}
+			row("env."+key, value)
+		}
+		row("timeout", report.Timeout)
+		row("capture", strings.Join(report.Capture, ","))
+		row("print", strings.Join(report.Print, ","))
+		row("session", report.Session)
+		for _, node := range report.Nodes {
+			switch {
+			case node.Error != "":
+				fmt.Fprintf(tw, "  node %s\t\terror: %s\n", node.Node, node.Error)
+			case len(node.Argv) > 0:
+				fmt.Fprintf(tw, "  node %s\t\t$ %s\n", node.Node, quoteArgs(node.Argv))
+			default:
+				fmt.Fprintf(tw, "  node %s\t\treplay from %s\n", node.Node, report.Run)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+func quoteArgs(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,111 @@
+package moleman
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveAgentReportsShowsProvenance(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFile(t, filepath.Join(tempDir, "agents.yaml"), `agents:
+  claude:
+    type: claude
+    model: sonnet
+    timeout: 30m
+`)
+	writeFile(t, filepath.Join(tempDir, "moleman.yaml"), `version: 1
+
+agents:
+  reviewer:
+    extends: claude
+    model: opus
+    env:
+      ANTHROPIC_API_KEY: sk-secret
+      MODE: review
+
+workflow:
+  - type: agent
+    name: review
+    agent: reviewer
+    input:
+      prompt: "review"
+    output:
+      toNext: true
+`)
+	cfg, err := LoadConfig(filepath.Join(tempDir, "moleman.yaml"))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	reports := ResolveAgentReports(cfg)
+	if len(reports) != 1 || reports[0].Name != "reviewer" {
+		t.Fatalf("expected only the used agent, got %+v", reports)
+	}
+	report := reports[0]
+	wantSources := map[string]string{
+		"type":                  "agents.yaml (claude)",
+		"timeout":               "agents.yaml (claude)",
+		"model":                 "moleman.yaml",
+		"command":               "default",
+		"env.ANTHROPIC_API_KEY": "moleman.yaml",
+	}
+	for field, want := range wantSources {
+		if report.Sources[field] != want {
+			t.Fatalf("source of %s: got %q, want %q", field, report.Sources[field], want)
+		}
+	}
+	if report.Env["ANTHROPIC_API_KEY"] != "****" || report.Env["MODE"] != "review" {
+		t.Fatalf("unexpected env masking: %v", report.Env)
+	}
+	argv := strings.Join(report.Nodes[0].Argv, " ")
+	if argv != "claude -p <input of review> --model opus" {
+		t.Fatalf("unexpected argv: %s", argv)
+	}
+
+	var out strings.Builder
+	if err := PrintAgents(&out, cfg, "text"); err != nil {
+		t.Fatalf("print agents: %v", err)
+	}
+	if strings.Contains(out.String(), "sk-secret") {
+		t.Fatalf("secret leaked:\n%s", out.String())
+	}
+}
+
+func TestPrintAgentsAppliesRedactPatterns(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	writeFile(t, filepath.Join(tempDir, "agents.yaml"), "agents: {}\n")
+	writeFile(t, filepath.Join(tempDir, "moleman.yaml"), `version: 1
+
+redact: ['ghp_[A-Za-z0-9]+']
+
+agents:
+  coder:
+    type: codex
+    command: ./bin/codex-ghp_cmd123
+    args: ["-c", "token=ghp_abcdef123456"]
+
+workflow:
+  - type: agent
+    name: write
+    agent: coder
+    input:
+      prompt: "write"
+    output:
+      toNext: true
+`)
+	cfg, err := LoadConfig(filepath.Join(tempDir, "moleman.yaml"))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	for _, format := range []string{"text", "json"} {
+		var out strings.Builder
+		if err := PrintAgents(&out, cfg, format); err != nil {
+			t.Fatalf("print agents: %v", err)
+		}
+		if strings.Contains(out.String(), "ghp_") || !strings.Contains(out.String(), "token=****") {
+			t.Fatalf("%s: expected redact patterns to be applied:\n%s", format, out.String())
+		}
+	}
+}
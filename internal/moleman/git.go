@@ -33,3 +33,7 @@ func runGitCommand(workdir string, args ...string) string {
 	}
 	return strings.TrimSpace(out.String())
 }
+
+func gitHead(workdir string) string {
+	return runGitCommand(workdir, "rev-parse", "HEAD")
+}
@@ -0,0 +1,355 @@
+package moleman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// workflowGraph is the workflow as a diagram: agent nodes, loops as clusters
+// holding an until node, flow edges in execution order and data edges from
+// input.from and .outputs references.
+type workflowGraph struct {
+	nodes map[string]graphNode
+	ids   map[string]string
+	root  *graphCluster
+	edges []graphEdge
+}
+
+type graphNode struct {
+	ID    string
+	Label string
+	Shape string // box, diamond or stadium
+}
+
+type graphCluster struct {
+	ID       string
+	Label    string
+	Nodes    []string
+	Clusters []*graphCluster
+}
+
+type graphEdge struct {
+	From  string
+	To    string
+	Label string
+	Data  bool
+}
+
+const graphInputID = "input"
+
+var graphIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+func buildWorkflowGraph(cfg *Config) *workflowGraph {
+	g := &workflowGraph{nodes: map[string]graphNode{}, ids: graphNodeIDs(cfg.Workflow), root: &graphCluster{}}
+	g.nodes[graphInputID] = graphNode{ID: graphInputID, Label: "input prompt", Shape: "stadium"}
+	g.root.Nodes = append(g.root.Nodes, graphInputID)
+	g.addItems(cfg.Workflow, nil, g.root, []string{graphInputID})
+
+	producers := map[string]string{}
+	for _, name := range producedNames(cfg.Workflow) {
+		producers[name] = g.nodeID(name)
+	}
+	g.addDataEdges(cfg.Workflow, producers)
+	g.addUntilEdges(cfg.Workflow, nil, producers)
+	return g
+}
+
+// graphNodeIDs assigns every agent node a diagram ID. Names that only
+// differ in characters IDs cannot hold, like a-b and a_b, get a numbered
+// suffix so they stay separate nodes.
+func graphNodeIDs(items []WorkflowItem) map[string]string {
+	ids := map[string]string{}
+	taken := map[string]bool{}
+	for _, item := range flattenAgentNodes(items) {
+		if _, ok := ids[item.Name]; ok {
+			continue
+		}
+		base := "n_" + graphIDUnsafe.ReplaceAllString(item.Name, "_")
+		id := base
+		for suffix := 2; taken[id]; suffix++ {
+			id = fmt.Sprintf("%s_%d", base, suffix)
+		}
+		taken[id] = true
+		ids[item.Name] = id
+	}
+	return ids
+}
+
+func (g *workflowGraph) nodeID(name string) string {
+	return g.ids[name]
+}
+
+func graphLoopID(location []int) string {
+	return "loop_" + strings.Trim(graphIDUnsafe.ReplaceAllString(workflowPath(location), "_"), "_")
+}
+
+// addItems adds items to cluster and links them in order, returning the
+// nodes control leaves the sequence from.
+func (g *workflowGraph) addItems(items []WorkflowItem, location []int, cluster *graphCluster, prev []string) []string {
+	for idx, item := range items {
+		path := append(append([]int(nil), location...), idx)
+		switch item.Type {
+		case "agent":
+			id := g.nodeID(item.Name)
+			g.nodes[id] = graphNode{ID: id, Label: fmt.Sprintf("%s\n%s", item.Name, item.Agent), Shape: "box"}
+			cluster.Nodes = append(cluster.Nodes, id)
+			g.link(prev, id, "")
+			prev = []string{id}
+		case "loop":
+			loop := &graphCluster{ID: graphLoopID(path), Label: fmt.Sprintf("loop ×%d", item.MaxIters)}
+			cluster.Clusters = append(cluster.Clusters, loop)
+			untilID := loop.ID + "_until"
+			g.nodes[untilID] = graphNode{ID: untilID, Label: "until " + item.Until, Shape: "diamond"}
+
+			bodyExits := g.addItems(item.Body, path, loop, prev)
+			loop.Nodes = append(loop.Nodes, untilID)
+			g.link(bodyExits, untilID, "")
+			if entry := g.entry(item.Body, path); entry != "" {
+				g.edges = append(g.edges, graphEdge{From: untilID, To: entry, Label: "repeat"})
+			}
+			prev = []string{untilID}
+		}
+	}
+	return prev
+}
+
+// entry returns the node control enters a sequence at.
+func (g *workflowGraph) entry(items []WorkflowItem, location []int) string {
+	if len(items) == 0 {
+		return ""
+	}
+	first := items[0]
+	path := append(append([]int(nil), location...), 0)
+	if first.Type == "loop" {
+		if entry := g.entry(first.Body, path); entry != "" {
+			return entry
+		}
+		return graphLoopID(path) + "_until"
+	}
+	return g.nodeID(first.Name)
+}
+
+func (g *workflowGraph) link(from []string, to, label string) {
+	for _, id := range from {
+		g.edges = append(g.edges, graphEdge{From: id, To: to, Label: label})
+	}
+}
+
+func (g *workflowGraph) addDataEdges(items []WorkflowItem, producers map[string]string) {
+	for _, item := range items {
+		switch item.Type {
+		case "agent":
+			id := g.nodeID(item.Name)
+			switch from := item.Input.From; from {
+			case "", "previous", "prev":
+			case "input":
+				g.addDataEdge(graphInputID, id, "input")
+			default:
+				if producer, ok := producers[from]; ok {
+					g.addDataEdge(producer, id, "from")
+				}
+			}
+			for _, text := range []string{item.Input.Prompt, item.Input.File, item.Output.File} {
+				refs, _ := templateOutputRefs(text)
+				g.addRefEdges(refs, id, producers)
+			}
+		case "loop":
+			g.addDataEdges(item.Body, producers)
+		}
+	}
+}
+
+func (g *workflowGraph) addUntilEdges(items []WorkflowItem, location []int, producers map[string]string) {
+	for idx, item := range items {
+		if item.Type != "loop" {
+			continue
+		}
+		path := append(append([]int(nil), location...), idx)
+		refs, _ := conditionOutputRefs(item.Until)
+		g.addRefEdges(refs, graphLoopID(path)+"_until", producers)
+		g.addUntilEdges(item.Body, path, producers)
+	}
+}
+
+func (g *workflowGraph) addRefEdges(refs []string, to string, producers map[string]string) {
+	for _, ref := range refs {
+		if producer, ok := producers[strings.TrimSuffix(ref, "_json")]; ok {
+			g.addDataEdge(producer, to, ref)
+		}
+	}
+}
+
+// addDataEdge labels an existing flow edge between the same nodes instead of
+// drawing a second arrow.
+func (g *workflowGraph) addDataEdge(from, to, label string) {
+	for idx, edge := range g.edges {
+		if edge.From != from || edge.To != to {
+			continue
+		}
+		if edge.Label == "" {
+			g.edges[idx].Label = label
+		}
+		return
+	}
+	g.edges = append(g.edges, graphEdge{From: from, To: to, Label: label, Data: true})
+}
+
+// PrintWorkflowGraph writes the workflow as json (the raw items), tree,
+// mermaid or dot.
+func PrintWorkflowGraph(w io.Writer, cfg *Config, format string) error {
+	switch format {
+	case "", "json":
+		raw, err := json.MarshalIndent(cfg.Workflow, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal workflow: %w", err)
+		}
+		_, err = fmt.Fprintf(w, "%s\n", raw)
+		return err
+	case "tree":
+		return writeWorkflowTree(w, cfg)
+	case "mermaid":
+		return buildWorkflowGraph(cfg).writeMermaid(w)
+	case "dot":
+		return buildWorkflowGraph(cfg).writeDot(w)
+	default:
+		return fmt.Errorf("unknown format: %s (want json, tree, mermaid or dot)", format)
+	}
+}
+
+func (g *workflowGraph) writeMermaid(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	var writeCluster func(cluster *graphCluster, indent string)
+	writeCluster = func(cluster *graphCluster, indent string) {
+		for _, id := range cluster.Nodes {
+			node := g.nodes[id]
+			label := mermaidLabel(node.Label)
+			switch node.Shape {
+			case "diamond":
+				fmt.Fprintf(&b, "%s%s{\"%s\"}\n", indent, id, label)
+			case "stadium":
+				fmt.Fprintf(&b, "%s%s([\"%s\"])\n", indent, id, label)
+			default:
+				fmt.Fprintf(&b, "%s%s[\"%s\"]\n", indent, id, label)
+			}
+		}
+		for _, child := range cluster.Clusters {
+			fmt.Fprintf(&b, "%ssubgraph %s[\"%s\"]\n", indent, child.ID, mermaidLabel(child.Label))
+			writeCluster(child, indent+"  ")
+			fmt.Fprintf(&b, "%send\n", indent)
+		}
+	}
+	writeCluster(g.root, "  ")
+	for _, edge := range g.edges {
+		arrow := "-->"
+		if edge.Data {
+			arrow = "-.->"
+		}
+		if edge.Label != "" {
+			fmt.Fprintf(&b, "  %s %s|\"%s\"| %s\n", edge.From, arrow, mermaidLabel(edge.Label), edge.To)
+			continue
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", edge.From, arrow, edge.To)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func mermaidLabel(text string) string {
+	replacer := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "\n", "<br/>")
+	return replacer.Replace(text)
+}
+
+func (g *workflowGraph) writeDot(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph workflow {\n  rankdir=TB;\n  node [shape=box];\n")
+	var writeCluster func(cluster *graphCluster, indent string)
+	writeCluster = func(cluster *graphCluster, indent string) {
+		for _, id := range cluster.Nodes {
+			node := g.nodes[id]
+			shape := node.Shape
+			if shape == "stadium" {
+				shape = "oval"
+			}
+			fmt.Fprintf(&b, "%s%s [label=\"%s\", shape=%s];\n", indent, id, dotLabel(node.Label), shape)
+		}
+		for _, child := range cluster.Clusters {
+			fmt.Fprintf(&b, "%ssubgraph cluster_%s {\n", indent, child.ID)
+			fmt.Fprintf(&b, "%s  label=\"%s\";\n", indent, dotLabel(child.Label))
+			writeCluster(child, indent+"  ")
+			fmt.Fprintf(&b, "%s}\n", indent)
+		}
+	}
+	writeCluster(g.root, "  ")
+	for _, edge := range g.edges {
+		attrs := []string{}
+		if edge.Label != "" {
+			attrs = append(attrs, fmt.Sprintf("label=\"%s\"", dotLabel(edge.Label)))
+		}
+		if edge.Data {
+			attrs = append(attrs, "style=dashed")
+		}
+		if len(attrs) == 0 {
+			fmt.Fprintf(&b, "  %s -> %s;\n", edge.From, edge.To)
+			continue
+		}
+		fmt.Fprintf(&b, "  %s -> %s [%s];\n", edge.From, edge.To, strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotLabel(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return replacer.Replace(text)
+}
+
+// writeWorkflowTree prints an indented tree listing, for each node, where its
+// input comes from.
+func writeWorkflowTree(w io.Writer, cfg *Config) error {
+	g := buildWorkflowGraph(cfg)
+	sources := map[string][]string{}
+	for _, edge := range g.edges {
+		if edge.Data || edge.Label != "" && edge.Label != "repeat" {
+			from := strings.SplitN(g.nodes[edge.From].Label, "\n", 2)[0]
+			if edge.From == graphInputID {
+				from = "input"
+			}
+			sources[edge.To] = append(sources[edge.To], from)
+		}
+	}
+	var b strings.Builder
+	b.WriteString(WorkflowName(cfg) + "\n")
+	var walk func(items []WorkflowItem, location []int, prefix string)
+	walk = func(items []WorkflowItem, location []int, prefix string) {
+		for idx, item := range items {
+			path := append(append([]int(nil), location...), idx)
+			branch, next := "├─ ", "│  "
+			if idx == len(items)-1 {
+				branch, next = "└─ ", "   "
+			}
+			switch item.Type {
+			case "agent":
+				line := fmt.Sprintf("%s (%s)", item.Name, item.Agent)
+				if from := sources[g.nodeID(item.Name)]; len(from) > 0 {
+					line += " ← " + strings.Join(from, ", ")
+				}
+				fmt.Fprintf(&b, "%s%s%s\n", prefix, branch, line)
+			case "loop":
+				line := fmt.Sprintf("loop ×%d until %s", item.MaxIters, item.Until)
+				if from := sources[graphLoopID(path)+"_until"]; len(from) > 0 {
+					line += " ← " + strings.Join(from, ", ")
+				}
+				fmt.Fprintf(&b, "%s%s%s\n", prefix, branch, line)
+				walk(item.Body, path, prefix+next)
+			}
+		}
+	}
+	walk(cfg.Workflow, nil, "")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
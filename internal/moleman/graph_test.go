@@ -0,0 +1,92 @@
+package moleman
+
+import (
+	"strings"
+	"testing"
+)
+
+func graphTestConfig() *Config {
+	return &Config{
+		Workflow: []WorkflowItem{
+			{Type: "agent", Name: "write", Agent: "codex", Input: InputSpec{From: "input"}, Output: OutputSpec{ToNext: true}},
+			{Type: "loop", MaxIters: 3, Until: `outputs.review == "ok"`, Body: []WorkflowItem{
+				{Type: "agent", Name: "review", Agent: "claude", Input: InputSpec{Prompt: `Review {{ index .outputs "write" }}`}, Output: OutputSpec{ToNext: true}},
+				{Type: "agent", Name: "fix", Agent: "codex", Input: InputSpec{From: "review"}, Output: OutputSpec{ToNext: true}},
+			}},
+		},
+	}
+}
+
+func TestPrintWorkflowGraphMermaid(t *testing.T) {
+	var out strings.Builder
+	if err := PrintWorkflowGraph(&out, graphTestConfig(), "mermaid"); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	for _, want := range []string{
+		`subgraph loop_workflow_1["loop ×3"]`,
+		`loop_workflow_1_until{"until outputs.review == #quot;ok#quot;"}`,
+		`input -->|"input"| n_write`,
+		`n_write -->|"write"| n_review`,
+		`n_review -->|"from"| n_fix`,
+		`n_fix --> loop_workflow_1_until`,
+		`n_review -.->|"review"| loop_workflow_1_until`,
+		`loop_workflow_1_until -->|"repeat"| n_review`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestPrintWorkflowGraphDotAndTree(t *testing.T) {
+	var dot strings.Builder
+	if err := PrintWorkflowGraph(&dot, graphTestConfig(), "dot"); err != nil {
+		t.Fatalf("render dot: %v", err)
+	}
+	if !strings.Contains(dot.String(), "subgraph cluster_loop_workflow_1 {") ||
+		!strings.Contains(dot.String(), `loop_workflow_1_until [label="until outputs.review == \"ok\"", shape=diamond];`) {
+		t.Fatalf("unexpected dot output:\n%s", dot.String())
+	}
+
+	var tree strings.Builder
+	if err := PrintWorkflowGraph(&tree, graphTestConfig(), "tree"); err != nil {
+		t.Fatalf("render tree: %v", err)
+	}
+	want := `workflow
+├─ write (codex) ← input
+└─ loop ×3 until outputs.review == "ok" ← review
+   ├─ review (claude) ← write
+   └─ fix (codex) ← review
+`
+	if tree.String() != want {
+		t.Fatalf("unexpected tree:\n%s", tree.String())
+	}
+
+	if err := PrintWorkflowGraph(&tree, graphTestConfig(), "svg"); err == nil {
+		t.Fatalf("expected unknown format error")
+	}
+}
+
+func TestPrintWorkflowGraphKeepsSimilarNamesApart(t *testing.T) {
+	cfg := &Config{Workflow: []WorkflowItem{
+		{Type: "agent", Name: "a-b", Agent: "codex", Output: OutputSpec{ToNext: true}},
+		{Type: "agent", Name: "a_b", Agent: "claude", Output: OutputSpec{ToNext: true}},
+		{Type: "agent", Name: "a.b", Agent: "codex", Input: InputSpec{From: "a-b"}, Output: OutputSpec{ToNext: true}},
+	}}
+	var out strings.Builder
+	if err := PrintWorkflowGraph(&out, cfg, "mermaid"); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	for _, want := range []string{
+		`n_a_b["a-b<br/>codex"]`,
+		`n_a_b_2["a_b<br/>claude"]`,
+		`n_a_b_3["a.b<br/>codex"]`,
+		`n_a_b --> n_a_b_2`,
+		`n_a_b_2 --> n_a_b_3`,
+		`n_a_b -.->|"from"| n_a_b_3`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in:\n%s", want, out.String())
+		}
+	}
+}
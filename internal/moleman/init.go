@@ -1,55 +1,347 @@
 package moleman
 
 import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
 )
 
-const defaultAgents = `agents:
-  codex:
-    type: codex
-    args: ["--full-auto"]
-    timeout: 45m
-    capture: [stdout, stderr, exitCode]
-`
-
-const defaultConfig = `version: 1
-
-workflow:
-  - type: agent
-    name: write
-    agent: codex
-    input:
-      from: input
-    output:
-      stdout: true
-`
-
-func Init(path string, force bool) error {
+//go:embed templates
+var initFS embed.FS
+
+// InitTemplate is a starter workflow written by moleman init. Roles are the
+// agents a user picks (writer, reviewer); Fixed templates only work with
+// their default agents.
+type InitTemplate struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Roles       []InitRole `json:"roles"`
+	Fixed       bool       `json:"fixed,omitempty"`
+	Files       []string   `json:"files,omitempty"`
+}
+
+type InitRole struct {
+	Name    string `json:"name"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+const defaultInitTemplate = "minimal"
+
+var (
+	writerRole   = InitRole{Name: "writer", Default: "codex", Usage: "writes and fixes code"}
+	reviewerRole = InitRole{Name: "reviewer", Default: "claude", Usage: "reviews the git diff"}
+)
+
+// initAgents are the agent CLIs a role can use, in order of preference.
+var initAgents = []string{"codex", "claude"}
+
+var initTemplates = []InitTemplate{
+	{
+		Name:        "minimal",
+		Description: "one agent run on the prompt",
+		Roles:       []InitRole{writerRole},
+	},
+	{
+		Name:        "write-review-loop",
+		Description: "write, review, then fix and re-review until nothing must be fixed",
+		Roles:       []InitRole{writerRole, reviewerRole},
+		Files:       []string{"schemas/review.json"},
+	},
+	{
+		Name:        "review-only",
+		Description: "review the uncommitted changes and print must-fix issues",
+		Roles:       []InitRole{reviewerRole},
+		Files:       []string{"schemas/review.json"},
+	},
+	{
+		Name:        "codex-claude",
+		Description: "Codex writes and fixes, Claude reviews, both resuming their sessions",
+		Roles:       []InitRole{writerRole, reviewerRole},
+		Fixed:       true,
+		Files:       []string{"schemas/review.json"},
+	},
+	{
+		Name:        "test-fix",
+		Description: "fix the code until a test command passes",
+		Roles:       []InitRole{writerRole},
+	},
+}
+
+// InitOptions selects what moleman init writes. Agents maps role names to
+// agent CLIs; unset roles take the template default.
+type InitOptions struct {
+	Template string
+	Agents   map[string]string
+	Force    bool
+}
+
+// InitTemplates lists the templates moleman init can write.
+func InitTemplates() []InitTemplate {
+	return append([]InitTemplate(nil), initTemplates...)
+}
+
+func findInitTemplate(name string) (InitTemplate, error) {
+	if name == "" {
+		name = defaultInitTemplate
+	}
+	names := make([]string, 0, len(initTemplates))
+	for _, tmpl := range initTemplates {
+		if tmpl.Name == name {
+			return tmpl, nil
+		}
+		names = append(names, tmpl.Name)
+	}
+	return InitTemplate{}, fmt.Errorf("unknown template: %s (want %s)", name, joinOr(names))
+}
+
+// PrintInitTemplates writes the templates as a table or json.
+func PrintInitTemplates(w io.Writer, format string) error {
+	switch format {
+	case "", "text":
+		tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tAGENTS\tDESCRIPTION")
+		for _, tmpl := range initTemplates {
+			agents := []string{}
+			for _, role := range tmpl.Roles {
+				agents = append(agents, role.Name+"="+role.Default)
+			}
+			name := tmpl.Name
+			if name == defaultInitTemplate {
+				name += " (default)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", name, strings.Join(agents, ", "), tmpl.Description)
+		}
+		return tw.Flush()
+	case "json":
+		raw, err := json.MarshalIndent(initTemplates, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal templates: %w", err)
+		}
+		_, err = fmt.Fprintf(w, "%s\n", raw)
+		return err
+	default:
+		return fmt.Errorf("unknown format: %s (want text or json)", format)
+	}
+}
+
+// Init writes the template's moleman.yaml to path, plus agents.yaml and any
+// schema files next to it. Those support files are kept when they already
+// exist unless force is set.
+func Init(path string, opts InitOptions) error {
 	if path == "" {
 		return fmt.Errorf("config path is empty")
 	}
-	if !force {
+	tmpl, err := findInitTemplate(opts.Template)
+	if err != nil {
+		return err
+	}
+	roles, err := initRoleAgents(tmpl, opts.Agents)
+	if err != nil {
+		return err
+	}
+	if !opts.Force {
 		if _, err := os.Stat(path); err == nil {
 			return fmt.Errorf("config already exists: %s", path)
 		}
 	}
 
+	files, err := renderInitTemplate(tmpl, roles)
+	if err != nil {
+		return err
+	}
 	configDir := filepath.Dir(path)
 	if err := os.MkdirAll(configDir, 0o755); err != nil {
 		return fmt.Errorf("create config dir: %w", err)
 	}
-	agentsPath := filepath.Join(configDir, "agents.yaml")
-	if _, err := os.Stat(agentsPath); err == nil && !force {
-		// Keep existing agents.yaml unless forced.
-	} else {
-		if err := os.WriteFile(agentsPath, []byte(defaultAgents), 0o644); err != nil {
-			return fmt.Errorf("write agents.yaml: %w", err)
+	for _, name := range append([]string{"agents.yaml"}, tmpl.Files...) {
+		target := filepath.Join(configDir, filepath.FromSlash(name))
+		if _, err := os.Stat(target); err == nil && !opts.Force {
+			// Keep existing support files unless forced.
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("create %s dir: %w", name, err)
+		}
+		if err := os.WriteFile(target, files[name], 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
 		}
 	}
-	if err := os.WriteFile(path, []byte(defaultConfig), 0o644); err != nil {
+	if err := os.WriteFile(path, files["moleman.yaml"], 0o644); err != nil {
 		return fmt.Errorf("write config: %w", err)
 	}
 	return nil
 }
+
+// initRoleAgents fills in the agent for every role of tmpl.
+func initRoleAgents(tmpl InitTemplate, agents map[string]string) (map[string]string, error) {
+	known := map[string]bool{}
+	for _, role := range tmpl.Roles {
+		known[role.Name] = true
+	}
+	for _, name := range sortedKeys(agents) {
+		if !known[name] {
+			return nil, fmt.Errorf("template %s has no %s agent", tmpl.Name, name)
+		}
+	}
+	roles := map[string]string{}
+	for _, role := range tmpl.Roles {
+		agent := agents[role.Name]
+		if agent == "" {
+			agent = role.Default
+		}
+		if !isOneOf(agent, initAgents) {
+			return nil, fmt.Errorf("unknown %s agent: %s (want %s)", role.Name, agent, joinOr(initAgents))
+		}
+		if tmpl.Fixed && agent != role.Default {
+			return nil, fmt.Errorf("template %s needs %s as the %s agent", tmpl.Name, role.Default, role.Name)
+		}
+		roles[role.Name] = agent
+	}
+	return roles, nil
+}
+
+// renderInitTemplate returns the template's files keyed by their path
+// relative to the config directory. Templates use [[ ]] delimiters so the
+// workflow's own {{ }} templates pass through.
+func renderInitTemplate(tmpl InitTemplate, roles map[string]string) (map[string][]byte, error) {
+	schema, err := initFS.ReadFile("templates/schemas/review.json")
+	if err != nil {
+		return nil, err
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, schema); err != nil {
+		return nil, fmt.Errorf("compact review schema: %w", err)
+	}
+	agents := []string{}
+	for _, agent := range roles {
+		if !isOneOf(agent, agents) {
+			agents = append(agents, agent)
+		}
+	}
+	sort.Strings(agents)
+	data := map[string]any{"agents": agents, "reviewSchema": compact.String()}
+	for role, agent := range roles {
+		data[role] = agent
+	}
+
+	files := map[string][]byte{}
+	for name, source := range map[string]string{
+		"moleman.yaml": path.Join("templates", tmpl.Name, "moleman.yaml"),
+		"agents.yaml":  "templates/agents.yaml",
+	} {
+		parsed, err := template.New(path.Base(source)).Delims("[[", "]]").
+			Option("missingkey=error").
+			ParseFS(initFS, source, "templates/reviewer.yaml")
+		if err != nil {
+			return nil, fmt.Errorf("parse template %s: %w", source, err)
+		}
+		var buf bytes.Buffer
+		if err := parsed.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("render template %s: %w", source, err)
+		}
+		files[name] = append(bytes.TrimRight(buf.Bytes(), "\n"), '\n')
+	}
+	for _, name := range tmpl.Files {
+		raw, err := initFS.ReadFile(path.Join("templates", name))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = raw
+	}
+	return files, nil
+}
+
+// DetectAgentCLIs returns the agent CLIs found on PATH.
+func DetectAgentCLIs() []string {
+	found := []string{}
+	for _, name := range initAgents {
+		if _, err := exec.LookPath(name); err == nil {
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+// InitInteractive asks for the template (unless opts names one) and the
+// agent behind each role, defaulting to the CLIs installed on PATH, then
+// calls Init.
+func InitInteractive(path string, opts InitOptions, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	ask := func(question, def string) (string, error) {
+		fmt.Fprintf(out, "%s [%s]: ", question, def)
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if answer := strings.TrimSpace(line); answer != "" {
+			return answer, nil
+		}
+		return def, nil
+	}
+
+	if opts.Template == "" {
+		fmt.Fprintln(out, "Templates:")
+		for idx, tmpl := range initTemplates {
+			fmt.Fprintf(out, "  %d) %s - %s\n", idx+1, tmpl.Name, tmpl.Description)
+		}
+		answer, err := ask("Template", defaultInitTemplate)
+		if err != nil {
+			return err
+		}
+		var idx int
+		if _, err := fmt.Sscanf(answer, "%d", &idx); err == nil && fmt.Sprint(idx) == answer {
+			if idx < 1 || idx > len(initTemplates) {
+				return fmt.Errorf("unknown template: %s", answer)
+			}
+			answer = initTemplates[idx-1].Name
+		}
+		opts.Template = answer
+	}
+	tmpl, err := findInitTemplate(opts.Template)
+	if err != nil {
+		return err
+	}
+
+	installed := DetectAgentCLIs()
+	if len(installed) == 0 {
+		fmt.Fprintf(out, "No agent CLIs found on PATH (looked for %s).\n", strings.Join(initAgents, ", "))
+	} else {
+		fmt.Fprintf(out, "Found agent CLIs: %s\n", strings.Join(installed, ", "))
+	}
+	agents := map[string]string{}
+	for _, role := range tmpl.Roles {
+		if agent := opts.Agents[role.Name]; agent != "" {
+			agents[role.Name] = agent
+			continue
+		}
+		if tmpl.Fixed {
+			if !isOneOf(role.Default, installed) {
+				fmt.Fprintf(out, "Warning: %s needs %s, which is not on PATH.\n", tmpl.Name, role.Default)
+			}
+			continue
+		}
+		def := role.Default
+		if !isOneOf(def, installed) && len(installed) > 0 {
+			def = installed[0]
+		}
+		answer, err := ask(fmt.Sprintf("%s agent, %s (%s)", role.Name, role.Usage, strings.Join(initAgents, ", ")), def)
+		if err != nil {
+			return err
+		}
+		agents[role.Name] = answer
+	}
+	opts.Agents = agents
+	return Init(path, opts)
+}
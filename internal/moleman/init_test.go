@@ -0,0 +1,98 @@
+package moleman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitTemplatesWriteLoadableConfigs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, tmpl := range InitTemplates() {
+		agentChoices := []map[string]string{nil}
+		if !tmpl.Fixed && len(tmpl.Roles) > 0 {
+			swapped := map[string]string{}
+			for _, role := range tmpl.Roles {
+				swapped[role.Name] = "claude"
+				if role.Default == "claude" {
+					swapped[role.Name] = "codex"
+				}
+			}
+			agentChoices = append(agentChoices, swapped)
+		}
+		for _, agents := range agentChoices {
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "moleman.yaml")
+			if err := Init(configPath, InitOptions{Template: tmpl.Name, Agents: agents}); err != nil {
+				t.Fatalf("init %s %v: %v", tmpl.Name, agents, err)
+			}
+			cfg, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatalf("load %s %v: %v", tmpl.Name, agents, err)
+			}
+			if err := ValidateConfig(cfg); err != nil {
+				t.Fatalf("validate %s %v: %v", tmpl.Name, agents, err)
+			}
+			for _, file := range append([]string{"agents.yaml"}, tmpl.Files...) {
+				if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+					t.Fatalf("%s: expected %s: %v", tmpl.Name, file, err)
+				}
+			}
+		}
+	}
+}
+
+func TestInitKeepsSupportFilesAndRejectsBadOptions(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "moleman.yaml")
+	writeFile(t, filepath.Join(dir, "agents.yaml"), "agents: {}\n")
+	if err := Init(configPath, InitOptions{Template: "review-only"}); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(dir, "agents.yaml")); string(raw) != "agents: {}\n" {
+		t.Fatalf("expected agents.yaml to be kept, got %q", raw)
+	}
+
+	for _, tc := range []struct {
+		opts InitOptions
+		want string
+	}{
+		{InitOptions{Template: "minimal"}, "config already exists"},
+		{InitOptions{Template: "pipeline", Force: true}, "unknown template: pipeline (want minimal, write-review-loop, review-only, codex-claude, or test-fix)"},
+		{InitOptions{Template: "codex-claude", Agents: map[string]string{"reviewer": "codex"}, Force: true}, "template codex-claude needs claude as the reviewer agent"},
+		{InitOptions{Template: "review-only", Agents: map[string]string{"writer": "codex"}, Force: true}, "template review-only has no writer agent"},
+		{InitOptions{Agents: map[string]string{"writer": "gemini"}, Force: true}, "unknown writer agent: gemini (want codex or claude)"},
+	} {
+		err := Init(configPath, tc.opts)
+		if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Fatalf("%+v: expected %q, got %v", tc.opts, tc.want, err)
+		}
+	}
+}
+
+func TestInitInteractivePrefersInstalledAgents(t *testing.T) {
+	bin := t.TempDir()
+	writeFile(t, filepath.Join(bin, "codex"), "#!/bin/sh\n")
+	if err := os.Chmod(filepath.Join(bin, "codex"), 0o755); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	t.Setenv("PATH", bin)
+
+	configPath := filepath.Join(t.TempDir(), "moleman.yaml")
+	var out bytes.Buffer
+	if err := InitInteractive(configPath, InitOptions{}, strings.NewReader("2\n\n\n"), &out); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if !strings.Contains(out.String(), "Found agent CLIs: codex") || !strings.Contains(out.String(), "reviewer agent, reviews the git diff (codex, claude) [codex]: ") {
+		t.Fatalf("unexpected prompts:\n%s", out.String())
+	}
+	raw, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	if !strings.Contains(string(raw), "extends: codex") || strings.Contains(string(raw), "claude") {
+		t.Fatalf("expected a codex reviewer, got:\n%s", raw)
+	}
+}
@@ -0,0 +1,223 @@
+package moleman
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MigrateConfig rewrites a version 1 config as version 2. It edits the
+// parsed yaml.Node tree, so comments and key order are kept.
+func MigrateConfig(file string, raw []byte) ([]byte, error) {
+	doc, err := parseYAML(file, raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: not a moleman config", file)
+	}
+	root := doc.Content[0]
+	switch version := configVersion(doc); version {
+	case 1:
+	case latestConfigVersion:
+		return nil, fmt.Errorf("%s is already version %d", file, version)
+	default:
+		return nil, fmt.Errorf("%s: version %d is not supported", file, version)
+	}
+	markBlankLines(doc, strings.Split(string(raw), "\n"))
+	yamlMapValue(root, "version").Value = strconv.Itoa(latestConfigVersion)
+	migrateWorkflowItems(yamlMapValue(root, "workflow"))
+	if workflows := yamlMapValue(root, "workflows"); workflows != nil && workflows.Kind == yaml.MappingNode {
+		for i := 1; i < len(workflows.Content); i += 2 {
+			migrateWorkflowItems(workflows.Content[i])
+		}
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("encode %s: %w", file, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("encode %s: %w", file, err)
+	}
+	return blankLineMarker.ReplaceAll(out.Bytes(), []byte("\n")), nil
+}
+
+// The encoder drops blank lines, so they are carried through as a marker
+// comment and restored after encoding.
+const blankLineComment = "#moleman:blank"
+
+var blankLineMarker = regexp.MustCompile(`(?m)^[ \t]*` + blankLineComment + `\n`)
+
+// markBlankLines prefixes the head comment of map keys and sequence items
+// that follow a blank line (above any comment lines) with the marker.
+func markBlankLines(node *yaml.Node, lines []string) {
+	mark := func(target *yaml.Node, line int) {
+		idx := line - 2
+		for idx >= 0 && strings.HasPrefix(strings.TrimSpace(lines[idx]), "#") {
+			idx--
+		}
+		if idx >= 0 && strings.TrimSpace(lines[idx]) == "" {
+			target.HeadComment = joinComments(blankLineComment, target.HeadComment)
+		}
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				mark(node.Content[i], node.Content[i].Line)
+			}
+			markBlankLines(node.Content[i+1], lines)
+		}
+	case yaml.SequenceNode:
+		for idx, child := range node.Content {
+			if idx > 0 {
+				mark(child, child.Line)
+			}
+			markBlankLines(child, lines)
+		}
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			markBlankLines(child, lines)
+		}
+	}
+}
+
+// MigrateConfigFile migrates the config at path to version 2. With write
+// set it replaces the file, after checking the result loads; otherwise it
+// returns the migrated config.
+func MigrateConfigFile(path string, write bool) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	migrated, err := MigrateConfig(path, raw)
+	if err != nil {
+		return nil, err
+	}
+	if !write {
+		return migrated, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat config: %w", err)
+	}
+	// Stage next to the config so agents files resolve the same way.
+	staged, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".migrate-*")
+	if err != nil {
+		return nil, fmt.Errorf("stage migrated config: %w", err)
+	}
+	defer os.Remove(staged.Name())
+	if _, err := staged.Write(migrated); err != nil {
+		staged.Close()
+		return nil, fmt.Errorf("stage migrated config: %w", err)
+	}
+	if err := staged.Close(); err != nil {
+		return nil, fmt.Errorf("stage migrated config: %w", err)
+	}
+	if _, err := LoadConfig(staged.Name()); err != nil {
+		return nil, fmt.Errorf("migrated config does not load: %w", err)
+	}
+	if err := os.Chmod(staged.Name(), info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("stage migrated config: %w", err)
+	}
+	if err := os.Rename(staged.Name(), path); err != nil {
+		return nil, fmt.Errorf("replace config: %w", err)
+	}
+	return migrated, nil
+}
+
+func migrateWorkflowItems(items *yaml.Node) {
+	if items == nil || items.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, item := range items.Content {
+		if item.Kind == yaml.MappingNode {
+			migrateWorkflowItem(item)
+		}
+	}
+}
+
+// migrateWorkflowItem turns a v1 workflow item into a v2 step: type is
+// dropped, name becomes id, input and output become inputs and outputs,
+// and loop settings move under loop with body renamed to steps.
+func migrateWorkflowItem(item *yaml.Node) {
+	itemType := ""
+	if value := yamlMapValue(item, "type"); value != nil {
+		itemType = value.Value
+	}
+	var loop *yaml.Node
+	content := []*yaml.Node{}
+	pendingComment := ""
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		key, value := item.Content[i], item.Content[i+1]
+		if pendingComment != "" {
+			key.HeadComment = joinComments(pendingComment, key.HeadComment)
+			pendingComment = ""
+		}
+		switch {
+		case key.Value == "type":
+			// Keep comments of the dropped key on the next one.
+			pendingComment = joinComments(key.HeadComment, key.LineComment)
+			continue
+		case key.Value == "name":
+			key.Value = "id"
+		case key.Value == "input" && itemType == "agent":
+			key.Value = "inputs"
+		case key.Value == "output" && itemType == "agent":
+			key.Value = "outputs"
+			renameMapKey(value, "toNext", "next")
+		case itemType == "loop" && (key.Value == "maxIters" || key.Value == "until" || key.Value == "body"):
+			if key.Value == "body" {
+				key.Value = "steps"
+				migrateWorkflowItems(value)
+			}
+			if loop == nil {
+				loop = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				loopKey := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "loop", HeadComment: key.HeadComment}
+				key.HeadComment = ""
+				content = append(content, loopKey, loop)
+			}
+			loop.Content = append(loop.Content, key, value)
+			continue
+		}
+		content = append(content, key, value)
+	}
+	if pendingComment != "" && len(content) > 0 {
+		content[0].HeadComment = joinComments(pendingComment, content[0].HeadComment)
+	}
+	item.Content = content
+}
+
+func renameMapKey(node *yaml.Node, from, to string) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == from {
+			node.Content[i].Value = to
+		}
+	}
+}
+
+func joinComments(comments ...string) string {
+	joined := ""
+	for _, comment := range comments {
+		if comment == "" {
+			continue
+		}
+		if joined != "" {
+			joined += "\n"
+		}
+		joined += comment
+	}
+	return joined
+}
@@ -0,0 +1,200 @@
+package moleman
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const migrateV1Config = `# Team workflow.
+version: 1
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+    capture: [stdout]
+
+workflow:
+  # Draft first.
+  - type: agent
+    name: write
+    agent: echo
+    input:
+      prompt: "write"
+    output:
+      toNext: true # handed to the loop
+
+  - type: loop
+    name: polish
+    maxIters: 2 # keep it short
+    until: "true"
+    body:
+      - type: agent
+        name: review
+        agent: echo
+        input:
+          from: write
+        output:
+          file: review.md
+`
+
+func TestMigrateConfigKeepsCommentsAndWorkflow(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, migrateV1Config)
+	before, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load v1 config: %v", err)
+	}
+
+	if _, err := MigrateConfigFile(configPath, true); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	raw, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("read migrated config: %v", err)
+	}
+	migrated := string(raw)
+	for _, want := range []string{
+		"# Team workflow.\nversion: 2\n",
+		"  # Draft first.\n  - id: write\n",
+		"    outputs:\n      next: true # handed to the loop\n\n  - id: polish\n    loop:\n      maxIters: 2 # keep it short\n",
+		"      steps:\n        - id: review\n",
+	} {
+		if !strings.Contains(migrated, want) {
+			t.Fatalf("migrated config missing %q:\n%s", want, migrated)
+		}
+	}
+
+	after, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load v2 config: %v\n%s", err, migrated)
+	}
+	beforeJSON, _ := json.Marshal(before.Workflow)
+	afterJSON, _ := json.Marshal(after.Workflow)
+	if string(beforeJSON) != string(afterJSON) {
+		t.Fatalf("workflow changed:\nv1: %s\nv2: %s", beforeJSON, afterJSON)
+	}
+
+	if _, err := MigrateConfigFile(configPath, false); err == nil || !strings.Contains(err.Error(), "already version 2") {
+		t.Fatalf("expected already migrated error, got %v", err)
+	}
+}
+
+func TestLoadConfigV2ReportsStepPaths(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, `version: 2
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+
+workflow:
+  - loop:
+      maxIters: 2
+      until: "true"
+      steps:
+        - id: review
+          agent: echo
+          inputs:
+            prompt: "review"
+          outputs:
+            type: yaml
+            next: true
+`)
+	_, err := LoadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "moleman.yaml:18:13: workflow[0].loop.steps[0].outputs.type must be one of text, json") {
+		t.Fatalf("expected v2 step path error, got %v", err)
+	}
+}
+
+func TestLoadConfigV2RejectsLoopWithAgentFields(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, `version: 2
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+
+workflow:
+  - id: write
+    agent: echo
+    inputs:
+      prompt: "write"
+    outputs:
+      next: true
+  - id: review
+    agent: echo
+    outputs:
+      next: true
+    loop:
+      maxIters: 2
+      until: "true"
+      steps:
+        - id: fix
+          agent: echo
+          inputs:
+            from: previous
+          outputs:
+            next: true
+`)
+	_, err := LoadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "moleman.yaml:15:5: workflow[1] cannot set agent, outputs together with loop") {
+		t.Fatalf("expected loop step error, got %v", err)
+	}
+}
+
+func TestRunV2TypedOutputs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	config := `version: 2
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+    capture: [stdout]
+
+workflow:
+  - id: first
+    agent: echo
+    inputs:
+      prompt: '%s'
+    outputs:
+      type: json
+      next: true
+      file: "%s/out.json"
+`
+	writeFile(t, configPath, fmt.Sprintf(config, `{"ok": true}`, tempDir))
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if _, err := Run(cfg, configPath, RunOptions{Workdir: tempDir}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if raw, err := os.ReadFile(filepath.Join(tempDir, "out.json")); err != nil || string(raw) != `{"ok": true}` {
+		t.Fatalf("expected output file alongside next, got %q (%v)", raw, err)
+	}
+
+	writeFile(t, configPath, fmt.Sprintf(config, "not json", tempDir))
+	cfg, err = LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if _, err := Run(cfg, configPath, RunOptions{Workdir: tempDir}); err == nil || !strings.Contains(err.Error(), "first output is not valid JSON") {
+		t.Fatalf("expected invalid JSON error, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package moleman
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParamSpec declares a workflow parameter. Values are exposed to templates
+// and conditions as .params.NAME; unset params take their default, or the
+// zero value of their type.
+type ParamSpec struct {
+	Type        string `yaml:"type,omitempty"`
+	Default     any    `yaml:"default,omitempty"`
+	Description string `yaml:"description,omitempty"`
+}
+
+var paramTypes = []string{"string", "int", "number", "bool"}
+
+// ParseVars reads --vars-file (a YAML or JSON map) and then repeated
+// --var key=value pairs, which take precedence.
+func ParseVars(pairs []string, varsFile string) (map[string]any, error) {
+	vars := map[string]any{}
+	if varsFile != "" {
+		raw, err := os.ReadFile(varsFile)
+		if err != nil {
+			return nil, fmt.Errorf("read vars file: %w", err)
+		}
+		if err := yaml.Unmarshal(raw, &vars); err != nil {
+			return nil, fmt.Errorf("parse vars file %s: %w", varsFile, err)
+		}
+		if vars == nil {
+			vars = map[string]any{}
+		}
+	}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid --var %q (want key=value)", pair)
+		}
+		vars[strings.TrimSpace(key)] = value
+	}
+	return vars, nil
+}
+
+// resolveParams applies vars over param defaults and converts every value
+// to its declared type.
+func resolveParams(specs map[string]ParamSpec, vars map[string]any) (map[string]any, error) {
+	unknown := []string{}
+	for name := range vars {
+		if _, ok := specs[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown param: %s", strings.Join(unknown, ", "))
+	}
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := map[string]any{}
+	for _, name := range names {
+		spec := specs[name]
+		if spec.Type != "" && !isOneOf(spec.Type, paramTypes) {
+			return nil, configErrorf("params."+name+".type", "must be one of %s", strings.Join(paramTypes, ", "))
+		}
+		value, set := vars[name]
+		if !set {
+			value = spec.Default
+		}
+		converted, err := coerceParam(spec.Type, value)
+		if err != nil {
+			if set {
+				return nil, fmt.Errorf("param %s: %w", name, err)
+			}
+			return nil, configErrorf("params."+name+".default", "%v", err)
+		}
+		values[name] = converted
+	}
+	return values, nil
+}
+
+func coerceParam(paramType string, value any) (any, error) {
+	switch paramType {
+	case "", "string":
+		if value == nil {
+			return "", nil
+		}
+		return fmt.Sprint(value), nil
+	case "int":
+		switch v := value.(type) {
+		case nil:
+			return 0, nil
+		case int:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int(v), nil
+			}
+		case string:
+			if parsed, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not an int", value)
+	case "number":
+		switch v := value.(type) {
+		case nil:
+			return 0.0, nil
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a number", value)
+	case "bool":
+		switch v := value.(type) {
+		case nil:
+			return false, nil
+		case bool:
+			return v, nil
+		case string:
+			if parsed, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a bool", value)
+	default:
+		return nil, fmt.Errorf("unsupported param type: %s", paramType)
+	}
+}
+
+// paramSpecs reads the params block of a parsed config.
+func paramSpecs(file string, doc *yaml.Node) (map[string]ParamSpec, error) {
+	specs := map[string]ParamSpec{}
+	if len(doc.Content) == 0 {
+		return specs, nil
+	}
+	value := yamlMapValue(doc.Content[0], "params")
+	if value == nil {
+		return specs, nil
+	}
+	if err := value.Decode(&specs); err != nil {
+		return nil, &ConfigError{File: file, Line: value.Line, Column: value.Column, Path: "params", Message: err.Error()}
+	}
+	return specs, nil
+}
+
+// bindWorkflowParams renders agent and maxIters templates of the items of
+// workflow and workflows in place, since they decide the workflow's shape
+// before the run starts. It returns the lines it rewrote.
+func bindWorkflowParams(file string, doc *yaml.Node, values map[string]any, version int) (map[int]bool, error) {
+	rewritten := map[int]bool{}
+	if doc == nil || len(doc.Content) == 0 {
+		return rewritten, nil
+	}
+	data := map[string]any{"params": values}
+	bind := func(value *yaml.Node, path, key string) error {
+		if value == nil || value.Kind != yaml.ScalarNode || !strings.Contains(value.Value, "{{") {
+			return nil
+		}
+		rendered, err := RenderTemplate(value.Value, data)
+		if err != nil {
+			return &ConfigError{File: file, Line: value.Line, Column: value.Column, Path: path + "." + key, Message: err.Error()}
+		}
+		rendered = strings.TrimSpace(rendered)
+		value.Value, value.Tag, value.Style = rendered, "!!str", 0
+		if key == "maxIters" {
+			if _, err := strconv.Atoi(rendered); err != nil {
+				return &ConfigError{File: file, Line: value.Line, Column: value.Column, Path: path + "." + key, Message: fmt.Sprintf("rendered %q, not an integer", rendered)}
+			}
+			value.Tag = "!!int"
+		}
+		rewritten[value.Line] = true
+		return nil
+	}
+	var walk func(items *yaml.Node, path string) error
+	walk = func(items *yaml.Node, path string) error {
+		if items == nil || items.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for idx, item := range items.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, idx)
+			if item.Kind != yaml.MappingNode {
+				continue
+			}
+			// Version 2 keeps loop settings and steps under loop.
+			loop, loopPath, body := item, itemPath, "body"
+			if version == 2 {
+				loop, loopPath, body = yamlMapValue(item, "loop"), itemPath+".loop", "steps"
+			}
+			if err := bind(yamlMapValue(item, "agent"), itemPath, "agent"); err != nil {
+				return err
+			}
+			if err := bind(yamlMapValue(loop, "maxIters"), loopPath, "maxIters"); err != nil {
+				return err
+			}
+			if err := walk(yamlMapValue(loop, body), loopPath+"."+body); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(yamlMapValue(doc.Content[0], "workflow"), "workflow"); err != nil {
+		return rewritten, err
+	}
+	if workflows := yamlMapValue(doc.Content[0], "workflows"); workflows != nil && workflows.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(workflows.Content); i += 2 {
+			if err := walk(workflows.Content[i+1], "workflows."+workflows.Content[i].Value); err != nil {
+				return rewritten, err
+			}
+		}
+	}
+	return rewritten, nil
+}
+
+func yamlMapValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+
+package moleman
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// startInProcessGroup runs the command in its own process group so that
+// cancellation reaches every child the agent spawns. On cancel the group gets
+// SIGTERM, then SIGKILL once the grace period elapses. The returned func must
+// be called after the command exits; it reaps any stragglers left in a
+// cancelled group.
+func startInProcessGroup(cmd *exec.Cmd, grace time.Duration) func() {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.WaitDelay = grace + time.Second
+
+	var mu sync.Mutex
+	var killTimer *time.Timer
+	pgid := 0
+	exited := false
+	cmd.Cancel = func() error {
+		group := -cmd.Process.Pid
+		if err := syscall.Kill(group, syscall.SIGTERM); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if !exited {
+			pgid = group
+			killTimer = time.AfterFunc(grace, func() {
+				_ = syscall.Kill(group, syscall.SIGKILL)
+			})
+		}
+		return nil
+	}
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		exited = true
+		if killTimer != nil {
+			killTimer.Stop()
+			_ = syscall.Kill(pgid, syscall.SIGKILL)
+		}
+	}
+}
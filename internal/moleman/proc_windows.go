@@ -0,0 +1,15 @@
+//go:build windows
+
+package moleman
+
+import (
+	"os/exec"
+	"time"
+)
+
+// startInProcessGroup falls back to killing only the agent process on
+// Windows, which has no process groups in the POSIX sense.
+func startInProcessGroup(cmd *exec.Cmd, grace time.Duration) func() {
+	cmd.WaitDelay = grace
+	return func() {}
+}
@@ -0,0 +1,183 @@
+package moleman
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProfileSpec is a named set of overrides selected with --profile, so one
+// config can run cheaply locally and thoroughly in CI.
+type ProfileSpec struct {
+	Description string                  `yaml:"description,omitempty"`
+	Params      map[string]any          `yaml:"params,omitempty"`
+	Agents      map[string]AgentConfig  `yaml:"agents,omitempty"`
+	Loops       map[string]LoopOverride `yaml:"loops,omitempty"`
+}
+
+// LoopOverride changes a named loop.
+type LoopOverride struct {
+	MaxIters int `yaml:"maxIters,omitempty"`
+}
+
+// LoadOptions select how a config is loaded.
+type LoadOptions struct {
+	// Vars are param values, as from --var and --vars-file.
+	Vars map[string]any
+	// Profile names the profile to apply; empty applies none.
+	Profile string
+	// Workflow names the entry of workflows to run; empty runs workflow:.
+	Workflow string
+	// Workdir is where the repo root agents.yaml is searched from; empty
+	// uses the config directory, as Run does.
+	Workdir string
+}
+
+// selectProfile reads profiles.NAME from a parsed config.
+func selectProfile(file string, doc *yaml.Node, name string) (ProfileSpec, error) {
+	profile := ProfileSpec{}
+	if name == "" {
+		return profile, nil
+	}
+	var profiles *yaml.Node
+	if len(doc.Content) > 0 {
+		profiles = yamlMapValue(doc.Content[0], "profiles")
+	}
+	value := yamlMapValue(profiles, name)
+	if value == nil {
+		names := []string{}
+		if profiles != nil && profiles.Kind == yaml.MappingNode {
+			for i := 0; i < len(profiles.Content); i += 2 {
+				names = append(names, profiles.Content[i].Value)
+			}
+		}
+		if len(names) == 0 {
+			return profile, fmt.Errorf("unknown profile: %s (config defines no profiles)", name)
+		}
+		sort.Strings(names)
+		return profile, fmt.Errorf("unknown profile: %s (want %s)", name, joinOr(names))
+	}
+	if err := value.Decode(&profile); err != nil {
+		return profile, &ConfigError{File: file, Line: value.Line, Column: value.Column, Path: "profiles." + name, Message: err.Error()}
+	}
+	return profile, nil
+}
+
+// profileVars layers vars over the profile's param values.
+func profileVars(profile ProfileSpec, vars map[string]any) map[string]any {
+	if len(profile.Params) == 0 {
+		return vars
+	}
+	merged := map[string]any{}
+	for key, value := range profile.Params {
+		merged[key] = value
+	}
+	for key, value := range vars {
+		merged[key] = value
+	}
+	return merged
+}
+
+// profileLayer returns the agent layer of the selected profile, checking it
+// only overrides agents defined in lower layers.
+func profileLayer(name string, profile ProfileSpec, layers []agentLayer) (agentLayer, error) {
+	for _, agent := range sortedKeys(profile.Agents) {
+		found := false
+		for _, layer := range layers {
+			if _, ok := layer.agents[agent]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return agentLayer{}, configErrorf("profiles."+name+".agents."+agent, "overrides unknown agent: %s", agent)
+		}
+	}
+	return agentLayer{label: "profile " + name, agents: profile.Agents}, nil
+}
+
+// toProfileConfigError points an error about an agent field at the profile
+// entry that set it.
+func toProfileConfigError(err error, cfg *Config) error {
+	var configErr *ConfigError
+	if cfg.profile == "" || !errors.As(err, &configErr) {
+		return err
+	}
+	parts := strings.SplitN(configErr.Path, ".", 3)
+	if len(parts) != 3 || parts[0] != "agents" {
+		return err
+	}
+	if cfg.agentSources[parts[1]][parts[2]] == "profile "+cfg.profile {
+		configErr.Path = "profiles." + cfg.profile + "." + configErr.Path
+	}
+	return err
+}
+
+// applyProfileLoops sets maxIters of the named loops.
+func applyProfileLoops(items []WorkflowItem, loops map[string]LoopOverride) {
+	for idx := range items {
+		if items[idx].Type != "loop" {
+			continue
+		}
+		if override, ok := loops[items[idx].Name]; ok && items[idx].Name != "" && override.MaxIters != 0 {
+			items[idx].MaxIters = override.MaxIters
+		}
+		applyProfileLoops(items[idx].Body, loops)
+	}
+}
+
+func validateProfiles(cfg *Config) error {
+	loopNames := map[string]bool{}
+	for _, set := range workflowSets(cfg) {
+		collectLoopNames(set.items, loopNames)
+	}
+	for _, name := range sortedKeys(cfg.Profiles) {
+		profile := cfg.Profiles[name]
+		path := "profiles." + name
+		for _, agent := range sortedKeys(profile.Agents) {
+			if _, ok := cfg.Agents[agent]; !ok {
+				return configErrorf(path+".agents."+agent, "overrides unknown agent: %s", agent)
+			}
+			if profile.Agents[agent].Extends != "" {
+				return configErrorf(path+".agents."+agent+".extends", "is not supported in profiles")
+			}
+		}
+		for _, loop := range sortedKeys(profile.Loops) {
+			if !loopNames[loop] {
+				return configErrorf(path+".loops."+loop, "references unknown loop: %s", loop)
+			}
+			if profile.Loops[loop].MaxIters <= 0 {
+				return configErrorf(path+".loops."+loop+".maxIters", "must be > 0")
+			}
+		}
+		for _, param := range sortedKeys(profile.Params) {
+			if _, ok := cfg.Params[param]; !ok {
+				return configErrorf(path+".params."+param, "sets unknown param: %s", param)
+			}
+		}
+	}
+	return nil
+}
+
+func collectLoopNames(items []WorkflowItem, names map[string]bool) {
+	for _, item := range items {
+		if item.Type == "loop" {
+			if item.Name != "" {
+				names[item.Name] = true
+			}
+			collectLoopNames(item.Body, names)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
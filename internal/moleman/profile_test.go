@@ -0,0 +1,105 @@
+package moleman
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profileConfig = `version: 1
+
+params:
+  target:
+    default: pkg
+
+agents:
+  review:
+    type: claude
+    model: sonnet
+    timeout: 10m
+
+profiles:
+  thorough:
+    params:
+      target: all
+    agents:
+      review:
+        model: opus
+        timeout: 30m
+    loops:
+      review_loop:
+        maxIters: 5
+
+workflow:
+  - type: loop
+    name: review_loop
+    maxIters: 2
+    until: "true"
+    body:
+      - type: agent
+        name: review
+        agent: review
+        input:
+          prompt: "review {{ .params.target }}"
+        output:
+          toNext: true
+`
+
+func TestLoadConfigAppliesProfile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, profileConfig)
+
+	plain, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if plain.Agents["review"].Model != "sonnet" || plain.Workflow[0].MaxIters != 2 || plain.paramValues["target"] != "pkg" {
+		t.Fatalf("profile applied without --profile: %+v", plain.Agents["review"])
+	}
+
+	cfg, err := LoadConfigWithOptions(configPath, LoadOptions{Profile: "thorough", Vars: map[string]any{"target": "cmd"}})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	agent := cfg.Agents["review"]
+	if agent.Type != "claude" || agent.Model != "opus" || agent.Timeout != "30m" {
+		t.Fatalf("unexpected agent: %+v", agent)
+	}
+	if got := cfg.agentSources["review"]["model"]; got != "profile thorough" {
+		t.Fatalf("unexpected model source: %q", got)
+	}
+	if cfg.Workflow[0].MaxIters != 5 {
+		t.Fatalf("expected loop maxIters 5, got %d", cfg.Workflow[0].MaxIters)
+	}
+	if cfg.paramValues["target"] != "cmd" {
+		t.Fatalf("expected --var to win over profile params, got %v", cfg.paramValues["target"])
+	}
+}
+
+func TestLoadConfigRejectsBadProfiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, profileConfig)
+	if _, err := LoadConfigWithOptions(configPath, LoadOptions{Profile: "fast"}); err == nil || !strings.Contains(err.Error(), "unknown profile: fast (want thorough)") {
+		t.Fatalf("expected unknown profile error, got %v", err)
+	}
+
+	writeFile(t, configPath, strings.Replace(profileConfig, "      review_loop:\n", "      fix_loop:\n", 1))
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "profiles.thorough.loops.fix_loop references unknown loop") {
+		t.Fatalf("expected unknown loop error, got %v", err)
+	}
+
+	writeFile(t, configPath, strings.Replace(profileConfig, "      review:\n        model: opus", "      reviewer:\n        model: opus", 1))
+	if _, err := LoadConfigWithOptions(configPath, LoadOptions{Profile: "thorough"}); err == nil || !strings.Contains(err.Error(), "profiles.thorough.agents.reviewer overrides unknown agent") {
+		t.Fatalf("expected unknown agent error, got %v", err)
+	}
+
+	writeFile(t, configPath, strings.Replace(profileConfig, "        timeout: 30m\n", "        thinking: low\n", 1))
+	_, err := LoadConfigWithOptions(configPath, LoadOptions{Profile: "thorough"})
+	if err == nil || !strings.Contains(err.Error(), "profiles.thorough.agents.review.thinking is only supported for codex") || !strings.Contains(err.Error(), ":20:") {
+		t.Fatalf("expected profile thinking error, got %v", err)
+	}
+}
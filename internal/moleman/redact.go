@@ -0,0 +1,203 @@
+package moleman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const redactedText = "****"
+
+// redactor masks secrets in logs and artifacts: values registered while the
+// run resolves env and ${VAR} references, and matches of the config's redact
+// patterns. A nil redactor masks nothing.
+type redactor struct {
+	values   []string
+	patterns []*regexp.Regexp
+}
+
+// Values shorter than this are not masked; replacing every "1" or "on" would
+// make logs unreadable without protecting anything.
+const minSecretLength = 4
+
+func newRedactor(patterns []string) (*redactor, error) {
+	r := &redactor{}
+	for idx, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, configErrorf(fmt.Sprintf("redact[%d]", idx), "is not a valid pattern: %v", err)
+		}
+		r.patterns = append(r.patterns, compiled)
+	}
+	return r, nil
+}
+
+func (r *redactor) add(value string) {
+	if r == nil || len(value) < minSecretLength {
+		return
+	}
+	for _, existing := range r.values {
+		if existing == value {
+			return
+		}
+	}
+	r.values = append(r.values, value)
+	// Longest first so a secret containing another is masked whole.
+	sort.Slice(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+}
+
+func (r *redactor) empty() bool {
+	return r == nil || (len(r.values) == 0 && len(r.patterns) == 0)
+}
+
+// mask replaces secret values and pattern matches with ****. Patterns with
+// capture groups mask only the groups, so `token=(\S+)` keeps `token=`.
+func (r *redactor) mask(text string) string {
+	if r.empty() {
+		return text
+	}
+	for _, value := range r.values {
+		text = strings.ReplaceAll(text, value, redactedText)
+	}
+	for _, pattern := range r.patterns {
+		text = maskPattern(pattern, text)
+	}
+	return text
+}
+
+func maskPattern(pattern *regexp.Regexp, text string) string {
+	matches := pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		spans := [][2]int{{match[0], match[1]}}
+		if len(match) > 2 {
+			spans = spans[:0]
+			for group := 2; group+1 < len(match); group += 2 {
+				if match[group] >= 0 {
+					spans = append(spans, [2]int{match[group], match[group+1]})
+				}
+			}
+		}
+		for _, span := range spans {
+			if span[0] < last {
+				continue
+			}
+			b.WriteString(text[last:span[0]])
+			b.WriteString(redactedText)
+			last = span[1]
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func (r *redactor) maskAll(values []string) []string {
+	masked := make([]string, len(values))
+	for idx, value := range values {
+		masked[idx] = r.mask(value)
+	}
+	return masked
+}
+
+// maskValue masks the strings inside event data.
+func (r *redactor) maskValue(value any) any {
+	if r.empty() {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		return r.mask(v)
+	case []string:
+		return r.maskAll(v)
+	case []any:
+		masked := make([]any, len(v))
+		for idx, item := range v {
+			masked[idx] = r.maskValue(item)
+		}
+		return masked
+	case map[string]any:
+		masked := make(map[string]any, len(v))
+		for key, item := range v {
+			masked[key] = r.maskValue(item)
+		}
+		return masked
+	default:
+		return value
+	}
+}
+
+var jsonString = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// maskJSON masks the string literals of encoded JSON, leaving keys, layout
+// and field order as they were.
+func (r *redactor) maskJSON(raw []byte) []byte {
+	if r.empty() {
+		return raw
+	}
+	return jsonString.ReplaceAllFunc(raw, func(literal []byte) []byte {
+		var text string
+		if err := json.Unmarshal(literal, &text); err != nil {
+			return literal
+		}
+		masked := r.mask(text)
+		if masked == text {
+			return literal
+		}
+		encoded, err := json.Marshal(masked)
+		if err != nil {
+			return literal
+		}
+		return encoded
+	})
+}
+
+// Output without a newline is flushed once this much is pending, so a
+// single huge line cannot grow the buffer without bound.
+const maxRedactPending = 64 << 10
+
+// redactWriter masks a stream line by line, so a secret split across
+// writes is still caught. Nothing is buffered while there is nothing to
+// mask. Call Flush after the last write.
+type redactWriter struct {
+	redactor *redactor
+	out      io.Writer
+	pending  []byte
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	if w.redactor.empty() && len(w.pending) == 0 {
+		return w.out.Write(p)
+	}
+	w.pending = append(w.pending, p...)
+	end := bytes.LastIndexByte(w.pending, '\n') + 1
+	if end == 0 && len(w.pending) < maxRedactPending {
+		return len(p), nil
+	}
+	if end == 0 {
+		end = len(w.pending)
+	}
+	chunk := w.pending[:end]
+	w.pending = append([]byte(nil), w.pending[end:]...)
+	if _, err := io.WriteString(w.out, w.redactor.mask(string(chunk))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *redactWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	chunk := w.pending
+	w.pending = nil
+	_, err := io.WriteString(w.out, w.redactor.mask(string(chunk)))
+	return err
+}
@@ -0,0 +1,104 @@
+package moleman
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactorMasksValuesAndPatterns(t *testing.T) {
+	r, err := newRedactor([]string{`sk-[A-Za-z0-9]+`, `password=(\S+)`})
+	if err != nil {
+		t.Fatalf("new redactor: %v", err)
+	}
+	r.add("hunter2-secret")
+	r.add("on")
+	got := r.mask("key sk-abc123 password=letmein user=hunter2-secret mode=on")
+	if got != "key **** password=**** user=**** mode=on" {
+		t.Fatalf("unexpected mask: %q", got)
+	}
+	raw := []byte("{\n  \"command\": \"run --key sk-abc123\",\n  \"exitCode\": 0\n}")
+	if got := string(r.maskJSON(raw)); got != "{\n  \"command\": \"run --key ****\",\n  \"exitCode\": 0\n}" {
+		t.Fatalf("unexpected masked json: %s", got)
+	}
+	if _, err := newRedactor([]string{"("}); err == nil || !strings.Contains(err.Error(), "redact[0]") {
+		t.Fatalf("expected pattern error, got %v", err)
+	}
+}
+
+func TestRedactWriterMasksSecretsSplitAcrossWrites(t *testing.T) {
+	r := &redactor{}
+	r.add("s3cr3t-value")
+	var out bytes.Buffer
+	w := &redactWriter{redactor: r, out: &out}
+	for _, chunk := range []string{"token s3cr", "3t-value\nnext ", "line"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if out.String() != "token ****\n" {
+		t.Fatalf("expected only complete lines before flush, got %q", out.String())
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if out.String() != "token ****\nnext line" {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+}
+
+func TestRunRedactsArtifactsButNotOutputs(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	config := `version: 1
+
+redact:
+  - 'sk-[a-z0-9]+'
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+    capture: [stdout]
+
+workflow:
+  - type: agent
+    name: first
+    agent: echo
+    input:
+      prompt: "key sk-abc123"
+    output:
+      file: "%s/out.txt"
+`
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(config, tempDir)), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	result, err := Run(cfg, configPath, RunOptions{Workdir: tempDir})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	for _, name := range []string{"input.md", "resolved-workflow.json", "events.jsonl", "summary.json", "nodes/first/meta.json", "nodes/first/stdout.log"} {
+		raw, err := os.ReadFile(filepath.Join(result.RunDir, name))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if strings.Contains(string(raw), "sk-abc123") {
+			t.Fatalf("%s leaks the secret:\n%s", name, raw)
+		}
+	}
+	stdoutLog, _ := os.ReadFile(filepath.Join(result.RunDir, "nodes", "first", "stdout.log"))
+	if string(stdoutLog) != "key ****" {
+		t.Fatalf("unexpected stdout.log: %q", stdoutLog)
+	}
+	output, err := os.ReadFile(filepath.Join(tempDir, "out.txt"))
+	if err != nil || string(output) != "key sk-abc123" {
+		t.Fatalf("expected unredacted output file, got %q (%v)", output, err)
+	}
+}
@@ -0,0 +1,135 @@
+package moleman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+)
+
+// replaySource serves recorded node executions from a previous run. The nth
+// execution of a node in the replaying run receives the nth recorded
+// execution of the same node.
+type replaySource struct {
+	runID  string
+	runDir string
+	nodes  map[string][]NodeResult
+	cursor map[string]int
+}
+
+func loadReplaySource(runsDir, id string) (*replaySource, error) {
+	run, err := ResolveRun(runsDir, id)
+	if err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	if run.Summary == nil {
+		return nil, fmt.Errorf("replay: run %s has no readable summary", run.ID)
+	}
+	source := &replaySource{
+		runID:  run.ID,
+		runDir: run.Dir,
+		nodes:  map[string][]NodeResult{},
+		cursor: map[string]int{},
+	}
+	for _, node := range run.Summary.Nodes {
+		if node.Status == "skipped" {
+			continue
+		}
+		source.nodes[node.Name] = append(source.nodes[node.Name], node)
+	}
+	return source, nil
+}
+
+func (r *replaySource) next(node string) (NodeResult, error) {
+	recorded := r.nodes[node]
+	idx := r.cursor[node]
+	if idx >= len(recorded) {
+		if len(recorded) == 0 {
+			return NodeResult{}, fmt.Errorf("replay: node %s did not run in %s", node, r.runID)
+		}
+		return NodeResult{}, fmt.Errorf("replay: node %s ran only %d time(s) in %s", node, len(recorded), r.runID)
+	}
+	r.cursor[node] = idx + 1
+	return recorded[idx], nil
+}
+
+// loadReplaySources resolves every run referenced by opts.Replay or by
+// type: replay agents. It must run before the new run dir exists so that
+// "latest" refers to a previous run.
+func loadReplaySources(cfg *Config, runsDir, replayAll string) (*replaySource, map[string]*replaySource, error) {
+	byRun := map[string]*replaySource{}
+	load := func(id string) (*replaySource, error) {
+		if source, ok := byRun[id]; ok {
+			return source, nil
+		}
+		source, err := loadReplaySource(runsDir, id)
+		if err != nil {
+			return nil, err
+		}
+		byRun[id] = source
+		return source, nil
+	}
+
+	var all *replaySource
+	if replayAll != "" {
+		source, err := load(replayAll)
+		if err != nil {
+			return nil, nil, err
+		}
+		all = source
+	}
+	agents := map[string]*replaySource{}
+	used := map[string]struct{}{}
+	collectAgentNames(cfg.Workflow, used)
+	for name := range used {
+		agent, ok := cfg.Agents[name]
+		if !ok || agent.Type != "replay" {
+			continue
+		}
+		source, err := load(agent.Run)
+		if err != nil {
+			return nil, nil, fmt.Errorf("agent %s: %w", name, err)
+		}
+		agents[name] = source
+	}
+	return all, agents, nil
+}
+
+func (ctx *RunContext) replayFor(agentName string) *replaySource {
+	if ctx.Replay != nil {
+		return ctx.Replay
+	}
+	return ctx.ReplayAgents[agentName]
+}
+
+// replayCommand returns the next recorded execution of the node without
+// invoking the agent.
+func replayCommand(ctx *RunContext, source *replaySource, nodeName, agentName string, agent AgentConfig, stepDir string) (*commandOutput, error) {
+	recorded, err := source.next(nodeName)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("node replay", "run", source.runID, "node", nodeName, "exit", recorded.ExitCode)
+	stdout, err := readReplayLog(source.runDir, recorded.StdoutLog)
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := readReplayLog(source.runDir, recorded.StderrLog)
+	if err != nil {
+		return nil, err
+	}
+	command := fmt.Sprintf("replay %s %s", source.runID, recorded.StdoutLog)
+	return cannedCommand(ctx, nodeName, agentName, agent, stepDir, command, stdout, stderr, recorded.ExitCode)
+}
+
+func readReplayLog(runDir, logPath string) ([]byte, error) {
+	if logPath == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(filepath.Join(runDir, logPath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("replay: read %s: %w", logPath, err)
+	}
+	return raw, nil
+}
@@ -1,13 +1,17 @@
 package moleman
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -19,6 +23,26 @@ type RunOptions struct {
 	Workdir    string
 	DryRun     bool
 	Verbose    bool
+	Version    string
+	Events     string
+	// Replay, when set, replays every agent node from this previous run
+	// (ID, unique prefix, or "latest") instead of invoking agents.
+	Replay string
+	// RunsDir overrides where run directories are created
+	// (default <workdir>/.moleman/runs).
+	RunsDir string
+	// Mocks, when non-nil, answers every agent node with the first matching
+	// scripted response instead of invoking agents; see moleman test.
+	Mocks []MockResponse
+	// OnEvent, when set, receives every event as it is emitted.
+	OnEvent func(Event)
+	// BeforeWrite, when set, is called with the path of every output.file
+	// before it is written, so moleman test can restore it afterwards.
+	BeforeWrite func(path string)
+	// Stdout and Stderr receive output.stdout and printed agent output;
+	// they default to the process streams.
+	Stdout io.Writer
+	Stderr io.Writer
 }
 
 type RunResult struct {
@@ -39,62 +63,201 @@ func Run(cfg *Config, cfgPath string, opts RunOptions) (*RunResult, error) {
 		return nil, err
 	}
 
-	runID := fmt.Sprintf("%s-workflow", time.Now().Format("20060102-150405"))
-	runDir := filepath.Join(workdir, ".moleman", "runs", runID)
-	if err := os.MkdirAll(runDir, 0o755); err != nil {
-		return nil, fmt.Errorf("create run dir: %w", err)
+	replayAll, replayAgents, err := loadReplaySources(cfg, RunsDir(workdir), opts.Replay)
+	if err != nil {
+		return nil, err
+	}
+
+	var mocks *mockSet
+	if opts.Mocks != nil {
+		mocks, err = newMockSet(opts.Mocks)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if err := writeArtifactsSkeleton(runDir, input, cfg.Workflow); err != nil {
+	runsDir := opts.RunsDir
+	if runsDir == "" {
+		runsDir = RunsDir(workdir)
+	}
+	started := time.Now()
+	runID, runDir, err := createRunDir(runsDir, started, WorkflowName(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	redact, err := newRedactor(cfg.Redact)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeArtifactsSkeleton(runDir, input, cfg.Workflow, redact); err != nil {
 		return &RunResult{RunDir: runDir}, err
 	}
 
-	ctx := &RunContext{
-		Input:       input,
-		Outputs:     map[string]any{},
-		Sessions:    map[string]string{},
-		RunDir:      runDir,
-		Workdir:     workdir,
-		Verbose:     opts.Verbose,
-		NodeResults: []NodeResult{},
+	budget, err := newBudget(cfg.Limits, started)
+	if err != nil {
+		return &RunResult{RunDir: runDir}, err
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-sigCtx.Done()
+		// Restore default handling so a second Ctrl-C exits immediately.
+		stop()
+	}()
+	runCtx := sigCtx
+	if budget.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(sigCtx, budget.Timeout)
+		defer cancel()
+	}
+
+	events, err := newEventLog(runID, runDir, opts.Events, opts.OnEvent)
+	if err != nil {
+		return &RunResult{RunDir: runDir}, err
 	}
+	defer events.Close()
 
-	if err := ensureAgentCommands(cfg, ctx.Workdir); err != nil {
-		writeSummary(runDir, "failed", err, ctx)
+	ctx := &RunContext{
+		Context:      runCtx,
+		Input:        input,
+		Outputs:      map[string]any{},
+		Sessions:     map[string]string{},
+		RunDir:       runDir,
+		Workdir:      workdir,
+		Verbose:      opts.Verbose,
+		Stdout:       opts.Stdout,
+		Stderr:       opts.Stderr,
+		Budget:       budget,
+		Events:       events,
+		Replay:       replayAll,
+		ReplayAgents: replayAgents,
+		Mocks:        mocks,
+		BeforeWrite:  opts.BeforeWrite,
+		Params:       cfg.paramValues,
+		Redactor:     redact,
+		NodeResults:  []NodeResult{},
+	}
+	manifest := newRunManifest(runID, cfgPath, opts.Version, workdir, cfg, started)
+	if err := writeSummary(ctx, cfg, manifest, "running", nil); err != nil {
 		return &RunResult{RunDir: runDir}, err
 	}
+	ctx.emit("run.started", "", "", map[string]any{
+		"configPath": cfgPath,
+		"configHash": manifest.ConfigHash,
+		"workdir":    workdir,
+		"runDir":     runDir,
+		"nodes":      len(flattenAgentNodes(cfg.Workflow)),
+		"dryRun":     opts.DryRun,
+		"replay":     opts.Replay,
+		"params":     cfg.paramValues,
+		"profile":    cfg.profile,
+		"workflow":   WorkflowName(cfg),
+	})
+
+	if ctx.Replay == nil && ctx.Mocks == nil {
+		if err := ensureAgentCommands(cfg, ctx.Workdir); err != nil {
+			finishRun(ctx, cfg, manifest, "failed", err)
+			return &RunResult{RunDir: runDir}, err
+		}
+	}
 
 	log.Info("run started", "nodes", len(cfg.Workflow))
 	log.Info("run artifacts", "path", runDir)
+	if agents := uncostedAgents(cfg); budget.MaxCostUSD > 0 && len(agents) > 0 && !opts.DryRun {
+		log.Warn("maxCostUSD only counts agents that report cost", "uncounted", strings.Join(agents, ","))
+	}
 
 	if opts.DryRun {
-		if err := writeSummary(runDir, "dry-run", nil, ctx); err != nil {
+		if err := dryRunWorkflow(ctx, cfg); err != nil {
+			finishRun(ctx, cfg, manifest, "failed", err)
+			return &RunResult{RunDir: runDir}, err
+		}
+		if err := finishRun(ctx, cfg, manifest, "dry-run", nil); err != nil {
 			return &RunResult{RunDir: runDir}, err
 		}
 		return &RunResult{RunDir: runDir}, nil
 	}
 
 	if err := executeWorkflow(ctx, cfg, cfg.Workflow); err != nil {
-		writeSummary(runDir, "failed", err, ctx)
+		if sigCtx.Err() != nil {
+			err = ErrCancelled
+		}
+		finishRun(ctx, cfg, manifest, runStatus(err), err)
 		return &RunResult{RunDir: runDir}, err
 	}
 
-	if err := writeSummary(runDir, "success", nil, ctx); err != nil {
+	if err := finishRun(ctx, cfg, manifest, "success", nil); err != nil {
 		return &RunResult{RunDir: runDir}, err
 	}
 
 	return &RunResult{RunDir: runDir}, nil
 }
 
+// createRunDir creates a new run directory named after the start time and
+// workflow, adding a numeric suffix when another run started in the same
+// second.
+func createRunDir(runsDir string, started time.Time, workflow string) (string, string, error) {
+	if err := os.MkdirAll(runsDir, 0o755); err != nil {
+		return "", "", fmt.Errorf("create run dir: %w", err)
+	}
+	base := started.Format("20060102-150405")
+	for attempt := 1; ; attempt++ {
+		runID := base + "-" + workflow
+		if attempt > 1 {
+			runID = fmt.Sprintf("%s-%d-%s", base, attempt, workflow)
+		}
+		runDir := filepath.Join(runsDir, runID)
+		err := os.Mkdir(runDir, 0o755)
+		if err == nil {
+			return runID, runDir, nil
+		}
+		if !os.IsExist(err) {
+			return "", "", fmt.Errorf("create run dir: %w", err)
+		}
+	}
+}
+
+// finishRun writes the final summary and emits run.finished.
+func finishRun(ctx *RunContext, cfg *Config, manifest RunManifest, status string, runErr error) error {
+	data := map[string]any{
+		"status":     status,
+		"durationMs": time.Since(manifest.StartedAt).Milliseconds(),
+		"usage":      ctx.Budget.Usage,
+	}
+	if runErr != nil {
+		data["error"] = runErr.Error()
+	}
+	ctx.emit("run.finished", "", "", data)
+	return writeSummary(ctx, cfg, manifest, status, runErr)
+}
+
+func runStatus(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrCancelled):
+		return "cancelled"
+	case errors.Is(err, ErrBudgetExceeded):
+		return "budget-exceeded"
+	default:
+		return "failed"
+	}
+}
+
 func ensureAgentCommands(cfg *Config, workdir string) error {
 	usedAgents := map[string]struct{}{}
 	collectAgentNames(cfg.Workflow, usedAgents)
 	for name := range usedAgents {
 		agent, ok := cfg.Agents[name]
-		if !ok {
+		if !ok || agent.Type == "replay" {
 			continue
 		}
-		command := resolveAgentCommand(agent)
+		command, err := expandEnvRefs(resolveAgentCommand(agent), nil)
+		if err != nil {
+			return fmt.Errorf("agent %s command: %w", name, err)
+		}
 		if command == "" {
 			return fmt.Errorf("agent %s has no command configured", name)
 		}
@@ -160,7 +323,11 @@ func validateOutputSchema(schemaPath, workdir string) error {
 	if schemaPath == "" {
 		return nil
 	}
-	resolved, err := RenderTemplate(schemaPath, map[string]any{})
+	resolved, err := expandEnvRefs(schemaPath, nil)
+	if err != nil {
+		return err
+	}
+	resolved, err = RenderTemplate(resolved, map[string]any{})
 	if err != nil {
 		return err
 	}
@@ -173,15 +340,15 @@ func validateOutputSchema(schemaPath, workdir string) error {
 	return nil
 }
 
-func writeArtifactsSkeleton(runDir string, input string, workflow []WorkflowItem) error {
-	if err := os.WriteFile(filepath.Join(runDir, "input.md"), []byte(input), 0o644); err != nil {
+func writeArtifactsSkeleton(runDir string, input string, workflow []WorkflowItem, redact *redactor) error {
+	if err := os.WriteFile(filepath.Join(runDir, "input.md"), []byte(redact.mask(input)), 0o644); err != nil {
 		return fmt.Errorf("write input.md: %w", err)
 	}
 	rawPlan, err := json.MarshalIndent(workflow, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal workflow: %w", err)
 	}
-	if err := os.WriteFile(filepath.Join(runDir, "resolved-workflow.json"), rawPlan, 0o644); err != nil {
+	if err := os.WriteFile(filepath.Join(runDir, "resolved-workflow.json"), redact.maskJSON(rawPlan), 0o644); err != nil {
 		return fmt.Errorf("write resolved workflow: %w", err)
 	}
 	dirs := []string{
@@ -196,25 +363,6 @@ func writeArtifactsSkeleton(runDir string, input string, workflow []WorkflowItem
 	return nil
 }
 
-func writeSummary(runDir, status string, err error, ctx *RunContext) error {
-	summary := struct {
-		Status string       `json:"status"`
-		Error  string       `json:"error,omitempty"`
-		Time   string       `json:"time"`
-		Nodes  []NodeResult `json:"nodes"`
-	}{
-		Status: status,
-		Time:   time.Now().Format(time.RFC3339),
-		Nodes:  ctx.NodeResults,
-	}
-	if err != nil {
-		summary.Error = err.Error()
-	}
-	raw, _ := json.MarshalIndent(summary, "", "  ")
-	content := "# moleman Run Summary\n\n" + string(raw) + "\n"
-	return os.WriteFile(filepath.Join(runDir, "summary.md"), []byte(content), 0o644)
-}
-
 func loadPrompt(prompt, promptFile string) (string, error) {
 	if prompt != "" && promptFile != "" {
 		return "", errors.New("provide only one of --prompt or --prompt-file")
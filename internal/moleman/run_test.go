@@ -1,9 +1,16 @@
 package moleman
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRunExecutesStepsAndWritesArtifacts(t *testing.T) {
@@ -56,6 +63,46 @@ workflow:
 	}
 }
 
+func TestRunExposesParamsToTemplates(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	config := `version: 1
+
+params:
+  target:
+    default: pkg
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+    capture: [stdout]
+
+workflow:
+  - type: agent
+    name: first
+    agent: echo
+    input:
+      prompt: "hello {{ .params.target }}"
+    output:
+      file: "%s/{{ .params.target }}.txt"
+`
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(config, tempDir)), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfigWithVars(configPath, map[string]any{"target": "cmd"})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if _, err := Run(cfg, configPath, RunOptions{Workdir: tempDir}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	raw, err := os.ReadFile(filepath.Join(tempDir, "cmd.txt"))
+	if err != nil || string(raw) != "hello cmd" {
+		t.Fatalf("expected rendered output file, got %q (%v)", raw, err)
+	}
+}
+
 func TestRunLoopStopsOnCondition(t *testing.T) {
 	tempDir := t.TempDir()
 	configPath := filepath.Join(tempDir, "moleman.yaml")
@@ -93,3 +140,486 @@ workflow:
 		t.Fatalf("expected loop exhaustion error")
 	}
 }
+
+func TestRunCommandCancelTerminatesProcessGroup(t *testing.T) {
+	stepDir := t.TempDir()
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	ctx := &RunContext{
+		Context:  cancelCtx,
+		Outputs:  map[string]any{},
+		Sessions: map[string]string{},
+		RunDir:   stepDir,
+		Workdir:  stepDir,
+	}
+	agent := AgentConfig{Type: "generic", Command: "sh"}
+
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	out, err := runCommand(ctx, "sleepy", "sh", "sh", []string{"-c", "sleep 30 & sleep 30; wait"}, agent, stepDir, "")
+	if err != nil {
+		t.Fatalf("run command: %v", err)
+	}
+	if out.Result.ExitCode != 130 {
+		t.Fatalf("expected exit code 130, got %d", out.Result.ExitCode)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("cancel took too long: %s", elapsed)
+	}
+}
+
+func TestRunStopsWhenAgentBudgetExhausted(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	config := `version: 1
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+
+limits:
+  maxAgentInvocations: 2
+
+workflow:
+  - type: loop
+    maxIters: 5
+    until: "outputs.echo_step == \"never\""
+    body:
+      - type: agent
+        name: echo_step
+        agent: echo
+        input:
+          prompt: "again"
+        output:
+          toNext: true
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "agents.yaml"), []byte("agents: {}\n"), 0o644); err != nil {
+		t.Fatalf("write agents: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	result, err := Run(cfg, configPath, RunOptions{})
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+	summary, err := os.ReadFile(filepath.Join(result.RunDir, "summary.json"))
+	if err != nil {
+		t.Fatalf("read summary: %v", err)
+	}
+	if !strings.Contains(string(summary), `"status": "budget-exceeded"`) {
+		t.Fatalf("expected budget-exceeded status, got:\n%s", summary)
+	}
+}
+
+func TestRunWritesEventStream(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	config := `version: 1
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+
+workflow:
+  - type: loop
+    maxIters: 2
+    until: "outputs.say == \"done\""
+    body:
+      - type: agent
+        name: say
+        agent: echo
+        input:
+          prompt: "done"
+        output:
+          toNext: true
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "agents.yaml"), []byte("agents: {}\n"), 0o644); err != nil {
+		t.Fatalf("write agents: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	result, err := Run(cfg, configPath, RunOptions{})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(result.RunDir, "events.jsonl"))
+	if err != nil {
+		t.Fatalf("read events: %v", err)
+	}
+	types := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("parse event %q: %v", line, err)
+		}
+		types = append(types, event.Type)
+		if event.Type == "condition.evaluated" && event.Data["value"] != true {
+			t.Fatalf("expected condition value true, got %v", event.Data["value"])
+		}
+	}
+	want := []string{"run.started", "loop.iteration", "node.started", "node.output", "node.finished", "condition.evaluated", "run.finished"}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected events:\n got %v\nwant %v", types, want)
+	}
+}
+
+func TestRunReplaysRecordedOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	config := `version: 1
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+
+workflow:
+  - type: loop
+    maxIters: 3
+    until: "outputs.say == \"done\""
+    body:
+      - type: agent
+        name: say
+        agent: echo
+        input:
+          prompt: "done"
+        output:
+          toNext: true
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "agents.yaml"), []byte("agents: {}\n"), 0o644); err != nil {
+		t.Fatalf("write agents: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	recorded, err := Run(cfg, configPath, RunOptions{})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	// The replay must not invoke the agent command at all.
+	cfg.Agents["echo"] = AgentConfig{Type: "generic", Command: "false"}
+	result, err := Run(cfg, configPath, RunOptions{Replay: "latest"})
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if result.RunDir == recorded.RunDir {
+		t.Fatalf("replay reused the recorded run dir")
+	}
+	summary, err := LoadRunSummary(result.RunDir)
+	if err != nil {
+		t.Fatalf("load summary: %v", err)
+	}
+	if summary.Status != "success" || len(summary.Nodes) != 1 {
+		t.Fatalf("unexpected replay summary: %+v", summary)
+	}
+	if !strings.HasPrefix(summary.Nodes[0].Command, "replay "+filepath.Base(recorded.RunDir)) {
+		t.Fatalf("unexpected replay command: %s", summary.Nodes[0].Command)
+	}
+	stdout, err := os.ReadFile(filepath.Join(result.RunDir, summary.Nodes[0].StdoutLog))
+	if err != nil || string(stdout) != "done" {
+		t.Fatalf("expected replayed stdout, got %q (%v)", stdout, err)
+	}
+
+	// A second loop iteration has no recorded output to replay.
+	cfg.Workflow[0].Until = "false"
+	if _, err := Run(cfg, configPath, RunOptions{Replay: filepath.Base(recorded.RunDir)}); err == nil || !strings.Contains(err.Error(), "ran only 1 time(s)") {
+		t.Fatalf("expected exhausted replay error, got %v", err)
+	}
+
+	cfg.Workflow[0].Until = "outputs.say == \"done\""
+	cfg.Agents["echo"] = AgentConfig{Type: "replay", Run: filepath.Base(recorded.RunDir)}
+	if _, err := Run(cfg, configPath, RunOptions{}); err != nil {
+		t.Fatalf("replay agent failed: %v", err)
+	}
+}
+
+func TestRunDryRunRendersCommands(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	config := `version: 1
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+    env:
+      MODE: "dry run"
+
+limits:
+  maxCostUSD: 5
+
+workflow:
+  - type: agent
+    name: first
+    agent: echo
+    input:
+      prompt: "hello {{ .input.prompt }}"
+    output:
+      toNext: true
+  - type: agent
+    name: second
+    agent: echo
+    input:
+      prompt: "got {{ .outputs.first }} and {{ .outputs.missing }}"
+    output:
+      stdout: true
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "agents.yaml"), []byte("agents: {}\n"), 0o644); err != nil {
+		t.Fatalf("write agents: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	var stdout strings.Builder
+	result, err := Run(cfg, configPath, RunOptions{Prompt: "world", DryRun: true, Stdout: &stdout})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	plan := stdout.String()
+	for _, want := range []string{
+		"env MODE='dry run'",
+		"$ printf 'hello world'",
+		"$ printf 'got <output of first> and <no value>'",
+		"input.prompt references outputs.missing, which no earlier node produces",
+		"limits.maxCostUSD does not count agents that report no cost: echo",
+	} {
+		if !strings.Contains(plan, want) {
+			t.Fatalf("expected plan to contain %q, got:\n%s", want, plan)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(result.RunDir, "nodes", "first")); !os.IsNotExist(err) {
+		t.Fatalf("dry run should not execute nodes")
+	}
+	if _, err := os.Stat(filepath.Join(result.RunDir, "plan.txt")); err != nil {
+		t.Fatalf("missing plan.txt: %v", err)
+	}
+}
+
+func TestRunDryRunOnlyResumesPlannedSessions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, `version: 1
+
+agents:
+  coder:
+    type: codex
+    command: printf
+  reviewer:
+    type: codex
+    command: printf
+  summarizer:
+    type: claude
+    command: printf
+
+workflow:
+  - type: agent
+    name: write
+    agent: coder
+    input:
+      prompt: "write"
+    output:
+      toNext: true
+  - type: agent
+    name: rereview
+    agent: reviewer
+    session:
+      resume: last
+    input:
+      prompt: "review"
+    output:
+      toNext: true
+  - type: agent
+    name: fix
+    agent: coder
+    session:
+      resume: last
+    input:
+      prompt: "fix"
+    output:
+      toNext: true
+  - type: agent
+    name: summarize
+    agent: summarizer
+    session:
+      resume: last
+    input:
+      prompt: "sum"
+    output:
+      stdout: true
+`)
+	writeFile(t, filepath.Join(tempDir, "agents.yaml"), "agents: {}\n")
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	var stdout strings.Builder
+	_, err = Run(cfg, configPath, RunOptions{DryRun: true, Stdout: &stdout})
+	if err == nil || !strings.Contains(err.Error(), "dry run found 1 problem(s)") {
+		t.Fatalf("expected the claude resume problem, got %v", err)
+	}
+	plan := stdout.String()
+	for _, want := range []string{
+		"$ printf exec --json review\n",
+		"$ printf exec --json resume '<codex session id>' fix\n",
+		"workflow[1] rereview: session.resume: no earlier reviewer session, a new one starts",
+		"workflow[3] summarize: command: claude resume requested but no session_id is available",
+	} {
+		if !strings.Contains(plan, want) {
+			t.Fatalf("expected plan to contain %q, got:\n%s", want, plan)
+		}
+	}
+
+	reports := ResolveAgentReports(cfg)
+	argv := map[string]string{}
+	for _, report := range reports {
+		for _, node := range report.Nodes {
+			argv[node.Node] = strings.Join(node.Argv, " ") + node.Error
+		}
+	}
+	if argv["rereview"] != "printf exec --json <input of rereview>" ||
+		argv["fix"] != "printf exec --json resume <codex session id> <input of fix>" ||
+		argv["summarize"] != "claude resume requested but no session_id is available" {
+		t.Fatalf("unexpected explain argv: %#v", argv)
+	}
+}
+
+func TestRunResumesCodexSessionByID(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	writeFile(t, filepath.Join(tempDir, "codex.sh"), `#!/bin/sh
+echo "$*" >> "$(dirname "$0")/calls.log"
+echo '{"type":"thread.started","thread_id":"thread-123"}'
+echo '{"type":"item.completed","item":{"id":"item_0","type":"agent_message","text":"{\"ok\": true}"}}'
+echo '{"type":"turn.completed","usage":{"input_tokens":3,"output_tokens":2}}'
+`)
+	if err := os.Chmod(filepath.Join(tempDir, "codex.sh"), 0o755); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	reviewPath := filepath.Join(tempDir, "review.json")
+	writeFile(t, configPath, fmt.Sprintf(`version: 1
+
+agents:
+  coder:
+    type: codex
+    command: ./codex.sh
+    print: [stdout]
+  reviewer:
+    extends: coder
+    outputSchema: schema.json
+
+workflow:
+  - type: agent
+    name: write
+    agent: coder
+    input:
+      prompt: "write"
+    output:
+      toNext: true
+  - type: agent
+    name: review
+    agent: reviewer
+    session:
+      resume: last
+    input:
+      prompt: "review {{ .outputs.write_json.structured_output.ok }}"
+    output:
+      file: %s
+  - type: agent
+    name: fix
+    agent: coder
+    session:
+      resume: last
+    input:
+      prompt: "fix"
+    output:
+      toNext: true
+`, reviewPath))
+	writeFile(t, filepath.Join(tempDir, "schema.json"), `{"type": "object"}`)
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	var stdout bytes.Buffer
+	outputs := []string{}
+	result, err := Run(cfg, configPath, RunOptions{Stdout: &stdout, OnEvent: func(event Event) {
+		if event.Type == "node.output" && event.Node == "write" {
+			outputs = append(outputs, fmt.Sprint(event.Data["text"]))
+		}
+	}})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if strings.Contains(stdout.String(), "thread.started") || !strings.Contains(stdout.String(), `{"ok": true}`) {
+		t.Fatalf("expected the agent message on the console, got:\n%s", stdout.String())
+	}
+	if got := strings.Join(outputs, ""); got != "{\"ok\": true}\n" {
+		t.Fatalf("expected node.output events with the agent message, got %q", got)
+	}
+	stdoutLog, err := os.ReadFile(filepath.Join(result.RunDir, "nodes", "write", "stdout.log"))
+	if err != nil || !strings.Contains(string(stdoutLog), `"thread.started"`) {
+		t.Fatalf("expected raw events in stdout.log, got %q (%v)", stdoutLog, err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(tempDir, "calls.log"))
+	if err != nil {
+		t.Fatalf("read calls: %v", err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	want := []string{
+		"exec --json write",
+		"exec --json --output-schema schema.json review true",
+		"exec --json resume thread-123 fix",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected codex calls:\n%s", raw)
+	}
+	review, err := os.ReadFile(reviewPath)
+	if err != nil || string(review) != `{"ok": true}` {
+		t.Fatalf("expected the last agent message as output, got %q (%v)", review, err)
+	}
+}
+
+func TestCodexOutputKeepsNonEventJSON(t *testing.T) {
+	agent := AgentConfig{Type: "codex"}
+	review := `{"type":"review","must_fix_count":0,"must_fix_items":[]}` + "\n"
+	if got := string(codexOutput(agent, []byte(review))); got != review {
+		t.Fatalf("expected JSON with a type field to be kept, got %q", got)
+	}
+	events := `{"type":"thread.started","thread_id":"t-1"}` + "\n" +
+		`{"type":"item.completed","item":{"id":"item_0","type":"agent_message","text":"done"}}` + "\n"
+	if got := string(codexOutput(agent, []byte(events))); got != "done" {
+		t.Fatalf("expected the agent message, got %q", got)
+	}
+	legacy := `{"id":"0","msg":{"type":"session_configured","session_id":"s-1"}}` + "\n" +
+		`{"id":"1","msg":{"type":"agent_message","message":"legacy"}}` + "\n"
+	if parsed := parseCodexEvents([]byte(legacy)); parsed.sessionID != "s-1" || parsed.message != "legacy" {
+		t.Fatalf("unexpected legacy parse: %+v", parsed)
+	}
+}
@@ -0,0 +1,359 @@
+package moleman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// RunInfo is the listing view of a past run directory.
+type RunInfo struct {
+	ID         string
+	Dir        string
+	Status     string
+	StartedAt  time.Time
+	DurationMs int64
+	Prompt     string
+	NodeCount  int
+	Summary    *RunSummary
+}
+
+func RunsDir(workdir string) string {
+	if workdir == "" {
+		workdir = "."
+	}
+	return filepath.Join(workdir, ".moleman", "runs")
+}
+
+// ListRuns returns runs newest first. Runs without a readable summary are
+// still listed with status "unknown".
+func ListRuns(runsDir string) ([]RunInfo, error) {
+	entries, err := os.ReadDir(runsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []RunInfo{}, nil
+		}
+		return nil, fmt.Errorf("read runs dir: %w", err)
+	}
+	runs := []RunInfo{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		runs = append(runs, loadRunInfo(filepath.Join(runsDir, entry.Name())))
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].StartedAt.Equal(runs[j].StartedAt) {
+			return runs[i].ID > runs[j].ID
+		}
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	return runs, nil
+}
+
+func loadRunInfo(dir string) RunInfo {
+	info := RunInfo{
+		ID:     filepath.Base(dir),
+		Dir:    dir,
+		Status: "unknown",
+		Prompt: promptExcerpt(dir),
+	}
+	if stat, err := os.Stat(dir); err == nil {
+		info.StartedAt = stat.ModTime()
+	}
+	summary, err := LoadRunSummary(dir)
+	if err != nil {
+		return info
+	}
+	info.Summary = summary
+	info.Status = summary.Status
+	info.DurationMs = summary.DurationMs
+	if !summary.StartedAt.IsZero() {
+		info.StartedAt = summary.StartedAt
+	}
+	for _, node := range summary.Nodes {
+		if node.Status != "skipped" {
+			info.NodeCount++
+		}
+	}
+	return info
+}
+
+// LoadRunSummary reads summary.json, falling back to the JSON embedded in
+// summary.md by older versions.
+func LoadRunSummary(runDir string) (*RunSummary, error) {
+	raw, err := os.ReadFile(filepath.Join(runDir, "summary.json"))
+	if err == nil {
+		summary := &RunSummary{}
+		if err := json.Unmarshal(raw, summary); err != nil {
+			return nil, fmt.Errorf("parse summary.json: %w", err)
+		}
+		return summary, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read summary.json: %w", err)
+	}
+	raw, err = os.ReadFile(filepath.Join(runDir, "summary.md"))
+	if err != nil {
+		return nil, fmt.Errorf("read summary: %w", err)
+	}
+	start := strings.Index(string(raw), "{")
+	if start < 0 {
+		return nil, fmt.Errorf("summary.md has no JSON payload")
+	}
+	var legacy struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Time   string `json:"time"`
+		Nodes  []struct {
+			Name     string
+			Agent    string
+			ExitCode int
+			Duration string
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(raw[start:], &legacy); err != nil {
+		return nil, fmt.Errorf("parse summary.md: %w", err)
+	}
+	summary := &RunSummary{Status: legacy.Status, Error: legacy.Error}
+	summary.RunID = filepath.Base(runDir)
+	if finished, err := time.Parse(time.RFC3339, legacy.Time); err == nil {
+		summary.FinishedAt = &finished
+	}
+	for _, node := range legacy.Nodes {
+		status := "success"
+		if node.ExitCode != 0 {
+			status = "failed"
+		}
+		duration, _ := time.ParseDuration(node.Duration)
+		summary.Nodes = append(summary.Nodes, NodeResult{
+			Name:       node.Name,
+			Agent:      node.Agent,
+			Status:     status,
+			ExitCode:   node.ExitCode,
+			DurationMs: duration.Milliseconds(),
+			StdoutLog:  filepath.Join("nodes", node.Name, "stdout.log"),
+			StderrLog:  filepath.Join("nodes", node.Name, "stderr.log"),
+		})
+	}
+	return summary, nil
+}
+
+func promptExcerpt(runDir string) string {
+	raw, err := os.ReadFile(filepath.Join(runDir, "input.md"))
+	if err != nil {
+		return ""
+	}
+	text := strings.Join(strings.Fields(string(raw)), " ")
+	const maxLen = 60
+	if len(text) > maxLen {
+		return text[:maxLen-3] + "..."
+	}
+	return text
+}
+
+// ResolveRun finds a run by exact ID, unique ID prefix, or "latest".
+func ResolveRun(runsDir, id string) (RunInfo, error) {
+	runs, err := ListRuns(runsDir)
+	if err != nil {
+		return RunInfo{}, err
+	}
+	if len(runs) == 0 {
+		return RunInfo{}, fmt.Errorf("no runs found in %s", runsDir)
+	}
+	if id == "latest" || id == "last" {
+		return runs[0], nil
+	}
+	matches := []RunInfo{}
+	for _, run := range runs {
+		if run.ID == id {
+			return run, nil
+		}
+		if strings.HasPrefix(run.ID, id) {
+			matches = append(matches, run)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return RunInfo{}, fmt.Errorf("run not found: %s", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return RunInfo{}, fmt.Errorf("run id %s is ambiguous (%d matches)", id, len(matches))
+	}
+}
+
+func PrintRuns(w io.Writer, runs []RunInfo) error {
+	if len(runs) == 0 {
+		_, err := fmt.Fprintln(w, "no runs")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tDURATION\tNODES\tPROMPT")
+	for _, run := range runs {
+		duration := "-"
+		if run.DurationMs > 0 {
+			duration = formatMs(run.DurationMs)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", run.ID, run.Status, duration, run.NodeCount, run.Prompt)
+	}
+	return tw.Flush()
+}
+
+// ShowRun prints the run summary followed by the tail of each node's logs.
+func ShowRun(w io.Writer, run RunInfo) error {
+	raw, err := os.ReadFile(filepath.Join(run.Dir, "summary.md"))
+	if err != nil {
+		return fmt.Errorf("read summary: %w", err)
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if run.Summary == nil {
+		return nil
+	}
+	for _, node := range run.Summary.Nodes {
+		if node.Status == "skipped" {
+			continue
+		}
+		label := node.Name
+		if len(node.Iteration) > 0 {
+			label += " (" + iterationLabel(node.Iteration) + ")"
+		}
+		fmt.Fprintf(w, "\n## %s [%s]\n", label, node.Status)
+		for _, logPath := range []string{node.StdoutLog, node.StderrLog} {
+			if logPath == "" {
+				continue
+			}
+			tail, err := tailFile(filepath.Join(run.Dir, logPath), 10)
+			if err != nil {
+				fmt.Fprintf(w, "\n%s: %v\n", logPath, err)
+				continue
+			}
+			if tail == "" {
+				fmt.Fprintf(w, "\n%s: (empty)\n", logPath)
+				continue
+			}
+			fmt.Fprintf(w, "\n%s (last 10 lines):\n```\n%s\n```\n", logPath, tail)
+		}
+	}
+	return nil
+}
+
+// OpenRunNode copies a node's stdout or stderr log to w. Without an explicit
+// iteration the latest execution of the node is used.
+func OpenRunNode(w io.Writer, run RunInfo, node, stream, iteration string) error {
+	if stream != "stdout" && stream != "stderr" {
+		return fmt.Errorf("stream must be stdout or stderr")
+	}
+	logPath := ""
+	if run.Summary != nil {
+		for _, result := range run.Summary.Nodes {
+			if result.Name != node || result.Status == "skipped" {
+				continue
+			}
+			if iteration != "" && strings.TrimPrefix(iterationLabel(result.Iteration), "iter-") != iteration {
+				continue
+			}
+			logPath = result.StdoutLog
+			if stream == "stderr" {
+				logPath = result.StderrLog
+			}
+		}
+	}
+	if logPath == "" {
+		return fmt.Errorf("node %s not found in run %s", node, run.ID)
+	}
+	file, err := os.Open(filepath.Join(run.Dir, logPath))
+	if err != nil {
+		return fmt.Errorf("open log: %w", err)
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+type PruneOptions struct {
+	Keep      int
+	OlderThan time.Duration
+	DryRun    bool
+}
+
+// PruneRuns removes runs beyond the newest Keep and/or older than OlderThan.
+// When both are set a run must satisfy both to be removed. Runs still marked
+// running are never removed.
+func PruneRuns(runsDir string, opts PruneOptions, now time.Time) ([]RunInfo, error) {
+	if opts.Keep <= 0 && opts.OlderThan <= 0 {
+		return nil, errors.New("provide --keep and/or --older-than")
+	}
+	runs, err := ListRuns(runsDir)
+	if err != nil {
+		return nil, err
+	}
+	removed := []RunInfo{}
+	for idx, run := range runs {
+		if run.Status == "running" {
+			continue
+		}
+		if opts.Keep > 0 && idx < opts.Keep {
+			continue
+		}
+		if opts.OlderThan > 0 && now.Sub(run.StartedAt) < opts.OlderThan {
+			continue
+		}
+		if !opts.DryRun {
+			if err := os.RemoveAll(run.Dir); err != nil {
+				return removed, fmt.Errorf("remove %s: %w", run.ID, err)
+			}
+		}
+		removed = append(removed, run)
+	}
+	return removed, nil
+}
+
+// ParseAge parses a duration that also accepts day (d) and week (w) units,
+// e.g. 7d or 2w.
+func ParseAge(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(value, suffix) {
+			count, err := strconv.ParseFloat(strings.TrimSuffix(value, suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid age: %s", value)
+			}
+			return time.Duration(count * float64(unit)), nil
+		}
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age: %s", value)
+	}
+	return parsed, nil
+}
+
+func tailFile(path string, lines int) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimRight(string(raw), "\n")
+	if text == "" {
+		return "", nil
+	}
+	parts := strings.Split(text, "\n")
+	if len(parts) > lines {
+		parts = parts[len(parts)-lines:]
+	}
+	return strings.Join(parts, "\n"), nil
+}
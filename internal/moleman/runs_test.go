@@ -0,0 +1,106 @@
+package moleman
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFakeRun(t *testing.T, runsDir, id, status string, started time.Time) {
+	t.Helper()
+	dir := filepath.Join(runsDir, id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	summary := RunSummary{
+		RunManifest: RunManifest{RunID: id, StartedAt: started},
+		Status:      status,
+		Nodes:       []NodeResult{{Name: "write", Status: "success"}, {Name: "review", Status: "skipped"}},
+	}
+	raw, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "summary.json"), raw, 0o644); err != nil {
+		t.Fatalf("write summary: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "input.md"), []byte("Fix the\nlint errors"), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+}
+
+func TestListRunsNewestFirst(t *testing.T) {
+	runsDir := t.TempDir()
+	now := time.Now()
+	writeFakeRun(t, runsDir, "old", "success", now.Add(-48*time.Hour))
+	writeFakeRun(t, runsDir, "new", "failed", now)
+
+	runs, err := ListRuns(runsDir)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != "new" || runs[1].ID != "old" {
+		t.Fatalf("unexpected order: %+v", runs)
+	}
+	if runs[0].NodeCount != 1 {
+		t.Fatalf("expected skipped nodes to be excluded, got %d", runs[0].NodeCount)
+	}
+	if runs[0].Prompt != "Fix the lint errors" {
+		t.Fatalf("unexpected prompt excerpt: %q", runs[0].Prompt)
+	}
+
+	run, err := ResolveRun(runsDir, "latest")
+	if err != nil || run.ID != "new" {
+		t.Fatalf("expected latest run, got %v %v", run.ID, err)
+	}
+}
+
+func TestPruneRunsKeepAndAge(t *testing.T) {
+	runsDir := t.TempDir()
+	now := time.Now()
+	writeFakeRun(t, runsDir, "a", "success", now.Add(-10*24*time.Hour))
+	writeFakeRun(t, runsDir, "b", "running", now.Add(-9*24*time.Hour))
+	writeFakeRun(t, runsDir, "c", "failed", now.Add(-8*24*time.Hour))
+	writeFakeRun(t, runsDir, "d", "success", now.Add(-1*time.Hour))
+
+	removed, err := PruneRuns(runsDir, PruneOptions{Keep: 1, OlderThan: 7 * 24 * time.Hour}, now)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 removed runs, got %+v", removed)
+	}
+	for _, id := range []string{"a", "c"} {
+		if _, err := os.Stat(filepath.Join(runsDir, id)); !os.IsNotExist(err) {
+			t.Fatalf("expected run %s to be removed", id)
+		}
+	}
+	for _, id := range []string{"b", "d"} {
+		if _, err := os.Stat(filepath.Join(runsDir, id)); err != nil {
+			t.Fatalf("expected run %s to be kept: %v", id, err)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	cases := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+		"":    0,
+	}
+	for input, want := range cases {
+		got, err := ParseAge(input)
+		if err != nil {
+			t.Fatalf("parse %q: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("parse %q = %s, want %s", input, got, want)
+		}
+	}
+	if _, err := ParseAge("soon"); err == nil {
+		t.Fatalf("expected error for invalid age")
+	}
+}
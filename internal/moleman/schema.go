@@ -0,0 +1,287 @@
+package moleman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Allowed values shared by the JSON Schema and ValidateConfig.
+var (
+	agentTypes          = []string{"codex", "claude", "generic", "replay"}
+	codexThinkingLevels = []string{"minimal", "low", "medium", "high", "xhigh"}
+	sessionResumeModes  = []string{"last", "new"}
+	captureStreams      = []string{"stdout", "stderr", "exitCode"}
+	printStreams        = []string{"stdout", "stderr"}
+	workflowItemTypes   = []string{"agent", "loop"}
+	inputSources        = []string{"prompt", "file", "from"}
+	outputTargets       = []string{"toNext", "file", "stdout"}
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaFields holds per-field keywords merged into the generated property
+// schemas, keyed by Go type name and YAML field name.
+var schemaFields = map[string]map[string]any{
+	"Config.version":        {"const": 1, "description": "Config format version."},
+	"Config.agentsFile":     {"description": "Agents file used instead of agents.yaml next to the config, relative to the config."},
+	"Config.params":         {"description": "Workflow parameters, exposed to templates as .params.NAME and set with --var or --vars-file."},
+	"ParamSpec.type":        {"enum": paramTypes, "description": "Value type; defaults to string."},
+	"ParamSpec.default":     {"description": "Value used when the param is not set."},
+	"ParamSpec.description": {"description": "Shown in documentation and tooling."},
+	"Config.agents":         {"description": "Agents by name; overrides or extends layered agents files."},
+	"Config.profiles":       {"description": "Named overrides selected with --profile."},
+	"ProfileSpec.params":    {"description": "Param values; --var and --vars-file take precedence."},
+	"ProfileSpec.agents":    {"description": "Agent fields merged over the resolved agents of the same name."},
+	"ProfileSpec.loops":     {"description": "Overrides for loops, by loop name."},
+	"LoopOverride.maxIters": {"minimum": 1},
+	"Config.limits":         {"description": "Run-wide budgets; unset or zero means unlimited."},
+	"Config.workflow":       {"description": "Default workflow: nodes run in order.", "minItems": 1},
+	"Config.workflows":      {"description": "Named workflows, run with moleman run NAME."},
+	"Config.redact": {
+		"description": "Regular expressions masked in logs, artifacts and events; with capture groups only the groups are masked.",
+		"items":       map[string]any{"type": "string", "format": "regex"},
+	},
+	"LimitsSpec.timeout": {"description": "Wall clock for the whole run (Go duration, e.g. 2h)."},
+	"LimitsSpec.maxAgentInvocations": {
+		"description": "Total agent nodes executed, across all loops.", "minimum": 0,
+	},
+	"LimitsSpec.maxTotalIterations": {
+		"description": "Total loop iterations, summed across nested loops.", "minimum": 0,
+	},
+	"LimitsSpec.maxCostUSD":    {"description": "Stop once reported agent cost reaches this amount.", "minimum": 0},
+	"AgentConfig.extends":      {"description": "Agent to merge over, in the same or a lower layer."},
+	"AgentConfig.type":         {"enum": agentTypes},
+	"AgentConfig.command":      {"description": "Executable; required for generic agents."},
+	"AgentConfig.run":          {"description": "Run ID, unique prefix or latest; replay agents only."},
+	"AgentConfig.model":        {"description": "Model name; codex and claude only."},
+	"AgentConfig.thinking":     {"enum": codexThinkingLevels, "description": "Reasoning effort; codex only."},
+	"AgentConfig.args":         {"description": "Extra arguments; replaces inherited args."},
+	"AgentConfig.argsAppend":   {"description": "Arguments appended to inherited args."},
+	"AgentConfig.outputSchema": {"description": "Codex JSON schema file."},
+	"AgentConfig.outputFile":   {"description": "File the last message is written to."},
+	"AgentConfig.env":          {"description": "Environment overrides, merged key by key over inherited env. Values may reference ${VAR} or ${VAR:-default}."},
+	"EnvValue.value":           {"description": "Literal value; may reference ${VAR} or ${VAR:-default}."},
+	"EnvValue.fromFile":        {"description": "File read at run time whose contents are the value; ~ is the home directory."},
+	"EnvValue.secret":          {"description": "Mask the resolved value in logs and artifacts."},
+	"AgentConfig.envUnset":     {"description": "Inherited env keys to remove."},
+	"AgentConfig.timeout":      {"description": "Per-invocation timeout (Go duration)."},
+	"AgentConfig.capture":      {"items": map[string]any{"type": "string", "enum": captureStreams}},
+	"AgentConfig.print":        {"items": map[string]any{"type": "string", "enum": printStreams}},
+	"WorkflowItem.type":        {"enum": workflowItemTypes},
+	"WorkflowItem.name":        {"description": "Node name, unique in the workflow; optional for loops."},
+	"WorkflowItem.agent":       {"description": "Key in agents."},
+	"WorkflowItem.maxIters":    {"minimum": 1},
+	"WorkflowItem.until":       {"description": "Condition evaluated after each iteration."},
+	"InputSpec.prompt":         {"description": "Prompt template."},
+	"InputSpec.file":           {"description": "File whose contents are the input."},
+	"InputSpec.from":           {"description": "input, previous, or a node name."},
+	"OutputSpec.toNext":        {"description": "Pass output to the next node and outputs."},
+	"OutputSpec.file":          {"description": "File the output is written to (template)."},
+	"OutputSpec.stdout":        {"description": "Print output to stdout."},
+	"SessionSpec.resume":       {"enum": sessionResumeModes},
+	"ConfigV2.version":         {"const": 2, "description": "Config format version."},
+	"Step.id":                  {"description": "Step id, unique in the workflow; optional for loops."},
+	"Step.agent":               {"description": "Key in agents."},
+	"Step.inputs":              {"description": "Exactly one of prompt, file or from."},
+	"Step.outputs":             {"description": "Where the output goes; any of next, file and stdout."},
+	"Step.loop":                {"description": "Makes the step a loop over steps."},
+	"StepOutputs.type":         {"enum": outputTypes, "description": "json fails the step unless the output is valid JSON; text never parses it."},
+	"StepOutputs.next":         {"description": "Pass output to the next step and outputs."},
+	"StepOutputs.file":         {"description": "File the output is written to (template)."},
+	"StepOutputs.stdout":       {"description": "Print output to stdout."},
+	"LoopSpec.maxIters":        {"minimum": 1},
+	"LoopSpec.until":           {"description": "Condition evaluated after each iteration."},
+}
+
+// schemaAliases lets a type reuse the keywords of another, so version 2
+// shares the descriptions of the version 1 fields it keeps.
+var schemaAliases = map[string]string{"ConfigV2": "Config"}
+
+// schemaTypes holds keywords added to the schema of a whole type, for
+// constraints spanning several fields.
+var schemaTypes = map[string]map[string]any{
+	"Config": {
+		"required": []string{"version"},
+		"anyOf":    []any{map[string]any{"required": []string{"workflow"}}, map[string]any{"required": []string{"workflows"}}},
+	},
+	"EnvValue":    {"type": []string{"string", "object"}},
+	"InputSpec":   {"oneOf": exactlyOneOf(inputSources, nil)},
+	"OutputSpec":  {"oneOf": exactlyOneOf(outputTargets, map[string]bool{"toNext": true, "stdout": true})},
+	"StepOutputs": {"anyOf": exactlyOneOf([]string{"next", "file", "stdout"}, map[string]bool{"next": true, "stdout": true})},
+	"LoopSpec":    {"required": []string{"maxIters", "until", "steps"}},
+	"Step": {
+		"oneOf": []any{
+			map[string]any{"required": []string{"id", "agent", "inputs", "outputs"}},
+			map[string]any{"required": []string{"loop"}},
+		},
+	},
+	"WorkflowItem": {
+		"required": []string{"type"},
+		"allOf": []any{
+			whenType("agent", "name", "agent", "input", "output"),
+			whenType("loop", "maxIters", "until", "body"),
+		},
+	},
+}
+
+func exactlyOneOf(fields []string, flags map[string]bool) []any {
+	branches := []any{}
+	for _, field := range fields {
+		branch := map[string]any{"required": []string{field}}
+		if flags[field] {
+			branch["properties"] = map[string]any{field: map[string]any{"const": true}}
+		}
+		branches = append(branches, branch)
+	}
+	return branches
+}
+
+func whenType(itemType string, required ...string) map[string]any {
+	return map[string]any{
+		"if": map[string]any{
+			"properties": map[string]any{"type": map[string]any{"const": itemType}},
+			"required":   []string{"type"},
+		},
+		"then": map[string]any{"required": required},
+	}
+}
+
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+// ConfigSchema returns the JSON Schema of a workflow config of either
+// version, generated from the Config and ConfigV2 types.
+func ConfigSchema() map[string]any {
+	g := &schemaGenerator{defs: map[string]any{}}
+	return map[string]any{
+		"$schema": jsonSchemaDialect,
+		"title":   "moleman workflow config",
+		"oneOf": []any{
+			g.schemaFor(reflect.TypeOf(Config{})),
+			g.schemaFor(reflect.TypeOf(ConfigV2{})),
+		},
+		"$defs": g.defs,
+	}
+}
+
+// AgentsSchema returns the JSON Schema of an agents.yaml file.
+func AgentsSchema() map[string]any {
+	g := &schemaGenerator{defs: map[string]any{}}
+	return map[string]any{
+		"$schema":              jsonSchemaDialect,
+		"title":                "moleman agents file",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"agents": map[string]any{
+				"type":                 "object",
+				"additionalProperties": g.schemaFor(reflect.TypeOf(AgentConfig{})),
+			},
+		},
+		"$defs": g.defs,
+	}
+}
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaFor(t.Elem())
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil // placeholder for recursive types
+			g.defs[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Interface:
+		return map[string]any{}
+	default:
+		panic(fmt.Sprintf("schema: unsupported kind %s", t.Kind()))
+	}
+}
+
+func (g *schemaGenerator) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		property := g.schemaFor(field.Type)
+		if alias, ok := schemaAliases[t.Name()]; ok {
+			for key, value := range schemaFields[alias+"."+name] {
+				property[key] = value
+			}
+		}
+		for key, value := range schemaFields[t.Name()+"."+name] {
+			property[key] = value
+		}
+		properties[name] = property
+	}
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	for key, value := range schemaTypes[schemaAliases[t.Name()]] {
+		schema[key] = value
+	}
+	for key, value := range schemaTypes[t.Name()] {
+		schema[key] = value
+	}
+	return schema
+}
+
+// PrintSchema writes the JSON Schema of a config (kind config) or agents
+// file (kind agents).
+func PrintSchema(w io.Writer, kind string) error {
+	var schema map[string]any
+	switch kind {
+	case "", "config":
+		schema = ConfigSchema()
+	case "agents":
+		schema = AgentsSchema()
+	default:
+		return fmt.Errorf("unknown schema: %s (want config or agents)", kind)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(schema)
+}
+
+func isOneOf(value string, values []string) bool {
+	for _, candidate := range values {
+		if value == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// joinOr lists values as "a, b, or c".
+func joinOr(values []string) string {
+	switch len(values) {
+	case 0, 1:
+		return strings.Join(values, "")
+	case 2:
+		return values[0] + " or " + values[1]
+	}
+	return strings.Join(values[:len(values)-1], ", ") + ", or " + values[len(values)-1]
+}
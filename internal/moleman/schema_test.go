@@ -0,0 +1,40 @@
+package moleman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPublishedSchemasAreCurrent(t *testing.T) {
+	for kind, file := range map[string]string{"config": "moleman.schema.json", "agents": "agents.schema.json"} {
+		var buf bytes.Buffer
+		if err := PrintSchema(&buf, kind); err != nil {
+			t.Fatalf("print %s schema: %v", kind, err)
+		}
+		published, err := os.ReadFile(filepath.Join("..", "..", "schemas", file))
+		if err != nil {
+			t.Fatalf("read published schema: %v", err)
+		}
+		if !bytes.Equal(buf.Bytes(), published) {
+			t.Fatalf("schemas/%s is out of date; run make schema", file)
+		}
+	}
+}
+
+func TestConfigSchemaCoversOneOfConstraints(t *testing.T) {
+	defs := ConfigSchema()["$defs"].(map[string]any)
+	input := defs["InputSpec"].(map[string]any)
+	if branches := input["oneOf"].([]any); len(branches) != len(inputSources) {
+		t.Fatalf("expected one branch per input source, got %v", branches)
+	}
+	item := defs["WorkflowItem"].(map[string]any)
+	properties := item["properties"].(map[string]any)
+	if body := properties["body"].(map[string]any); body["items"].(map[string]any)["$ref"] != "#/$defs/WorkflowItem" {
+		t.Fatalf("expected loop body to reference WorkflowItem, got %v", body)
+	}
+	if _, ok := properties["session"]; !ok {
+		t.Fatalf("expected workflow item session property")
+	}
+}
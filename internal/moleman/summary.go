@@ -0,0 +1,251 @@
+package moleman
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RunManifest describes a run as it starts.
+type RunManifest struct {
+	RunID          string         `json:"runId"`
+	MolemanVersion string         `json:"molemanVersion,omitempty"`
+	ConfigPath     string         `json:"configPath"`
+	ConfigHash     string         `json:"configHash"`
+	Workdir        string         `json:"workdir"`
+	StartedAt      time.Time      `json:"startedAt"`
+	GitHeadBefore  string         `json:"gitHeadBefore,omitempty"`
+	Params         map[string]any `json:"params,omitempty"`
+	Profile        string         `json:"profile,omitempty"`
+	Workflow       string         `json:"workflow,omitempty"`
+}
+
+// RunSummary is the machine-readable record written to summary.json.
+type RunSummary struct {
+	RunManifest
+	Status       string       `json:"status"`
+	Error        string       `json:"error,omitempty"`
+	FinishedAt   *time.Time   `json:"finishedAt,omitempty"`
+	DurationMs   int64        `json:"durationMs"`
+	GitHeadAfter string       `json:"gitHeadAfter,omitempty"`
+	Usage        Usage        `json:"usage"`
+	Nodes        []NodeResult `json:"nodes"`
+}
+
+func newRunManifest(runID, cfgPath, version, workdir string, cfg *Config, started time.Time) RunManifest {
+	return RunManifest{
+		RunID:          runID,
+		MolemanVersion: version,
+		ConfigPath:     cfgPath,
+		ConfigHash:     configHash(cfg),
+		Workdir:        workdir,
+		StartedAt:      started,
+		GitHeadBefore:  gitHead(workdir),
+		Params:         cfg.paramValues,
+		Profile:        cfg.profile,
+		Workflow:       cfg.workflowName,
+	}
+}
+
+// configHash fingerprints the resolved config (after agent merging), so two
+// runs with the same hash executed the same workflow and agent settings.
+func configHash(cfg *Config) string {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func buildRunSummary(ctx *RunContext, cfg *Config, manifest RunManifest, status string, err error) RunSummary {
+	summary := RunSummary{
+		RunManifest: manifest,
+		Status:      status,
+		Usage:       ctx.Budget.Usage,
+		Nodes:       summarizeNodes(ctx.NodeResults, cfg.Workflow),
+	}
+	if err != nil {
+		summary.Error = ctx.Redactor.mask(err.Error())
+	}
+	if status != "running" {
+		finished := time.Now()
+		summary.FinishedAt = &finished
+		summary.DurationMs = finished.Sub(manifest.StartedAt).Milliseconds()
+		summary.GitHeadAfter = gitHead(manifest.Workdir)
+	}
+	return summary
+}
+
+// summarizeNodes appends workflow nodes that never ran as skipped. Runs of
+// a node in different loop iterations keep their own entry and status.
+func summarizeNodes(results []NodeResult, workflow []WorkflowItem) []NodeResult {
+	nodes := make([]NodeResult, len(results))
+	copy(nodes, results)
+	ran := map[string]bool{}
+	for _, node := range nodes {
+		ran[node.Name] = true
+	}
+	for _, item := range flattenAgentNodes(workflow) {
+		if !ran[item.Name] {
+			nodes = append(nodes, NodeResult{Name: item.Name, Agent: item.Agent, Status: "skipped"})
+		}
+	}
+	return nodes
+}
+
+func flattenAgentNodes(items []WorkflowItem) []WorkflowItem {
+	nodes := []WorkflowItem{}
+	for _, item := range items {
+		switch item.Type {
+		case "agent":
+			nodes = append(nodes, item)
+		case "loop":
+			nodes = append(nodes, flattenAgentNodes(item.Body)...)
+		}
+	}
+	return nodes
+}
+
+func writeSummary(ctx *RunContext, cfg *Config, manifest RunManifest, status string, err error) error {
+	summary := buildRunSummary(ctx, cfg, manifest, status, err)
+	raw, marshalErr := json.MarshalIndent(summary, "", "  ")
+	if marshalErr != nil {
+		return fmt.Errorf("marshal summary: %w", marshalErr)
+	}
+	if err := os.WriteFile(filepath.Join(ctx.RunDir, "summary.json"), append(ctx.Redactor.maskJSON(raw), '\n'), 0o644); err != nil {
+		return fmt.Errorf("write summary.json: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(ctx.RunDir, "summary.md"), []byte(ctx.Redactor.mask(renderSummaryMarkdown(summary))), 0o644); err != nil {
+		return fmt.Errorf("write summary.md: %w", err)
+	}
+	return nil
+}
+
+func renderSummaryMarkdown(summary RunSummary) string {
+	var b strings.Builder
+	b.WriteString("# moleman Run Summary\n\n")
+	b.WriteString("| Field | Value |\n|---|---|\n")
+	rows := [][2]string{
+		{"Run", summary.RunID},
+		{"Status", summary.Status},
+		{"Started", summary.StartedAt.Format(time.RFC3339)},
+	}
+	if summary.FinishedAt != nil {
+		rows = append(rows,
+			[2]string{"Finished", summary.FinishedAt.Format(time.RFC3339)},
+			[2]string{"Duration", formatMs(summary.DurationMs)},
+		)
+	}
+	rows = append(rows,
+		[2]string{"Config", fmt.Sprintf("%s (`%s`)", summary.ConfigPath, shortHash(summary.ConfigHash))},
+		[2]string{"moleman", summary.MolemanVersion},
+	)
+	if summary.Workflow != "" {
+		rows = append(rows, [2]string{"Workflow", summary.Workflow})
+	}
+	if summary.Profile != "" {
+		rows = append(rows, [2]string{"Profile", summary.Profile})
+	}
+	rows = append(rows,
+		[2]string{"Git HEAD", formatGitHeads(summary.GitHeadBefore, summary.GitHeadAfter)},
+		[2]string{"Tokens", formatTokens(summary.Usage.TotalTokens)},
+		[2]string{"Cost", formatCost(summary.Usage.CostUSD)},
+	)
+	for _, row := range rows {
+		fmt.Fprintf(&b, "| %s | %s |\n", row[0], markdownCell(row[1]))
+	}
+	if summary.Error != "" {
+		fmt.Fprintf(&b, "\n## Error\n\n```\n%s\n```\n", summary.Error)
+	}
+
+	b.WriteString("\n## Nodes\n\n")
+	if len(summary.Nodes) == 0 {
+		b.WriteString("No nodes executed.\n")
+		return b.String()
+	}
+	b.WriteString("| # | Node | Agent | Iteration | Status | Exit | Duration | Tokens | Cost | Logs |\n")
+	b.WriteString("|---|---|---|---|---|---|---|---|---|---|\n")
+	for idx, node := range summary.Nodes {
+		if node.Status == "skipped" {
+			fmt.Fprintf(&b, "| %d | %s | %s | | skipped | | | | | |\n", idx+1, markdownCell(node.Name), markdownCell(node.Agent))
+			continue
+		}
+		tokens, cost := "", ""
+		if node.Usage != nil {
+			tokens = formatTokens(node.Usage.TotalTokens)
+			cost = formatCost(node.Usage.CostUSD)
+		}
+		iteration := ""
+		if len(node.Iteration) > 0 {
+			iteration = strings.TrimPrefix(iterationLabel(node.Iteration), "iter-")
+		}
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %d | %s | %s | %s | %s |\n",
+			idx+1,
+			markdownCell(node.Name),
+			markdownCell(node.Agent),
+			iteration,
+			node.Status,
+			node.ExitCode,
+			formatMs(node.DurationMs),
+			tokens,
+			cost,
+			markdownCell(filepath.Dir(node.StdoutLog)),
+		)
+	}
+	return b.String()
+}
+
+func markdownCell(value string) string {
+	value = strings.ReplaceAll(value, "|", "\\|")
+	return strings.ReplaceAll(value, "\n", " ")
+}
+
+func shortHash(hash string) string {
+	hash = strings.TrimPrefix(hash, "sha256:")
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
+
+func formatGitHeads(before, after string) string {
+	switch {
+	case before == "" && after == "":
+		return "n/a"
+	case after == "" || before == after:
+		return shortSHA(before)
+	default:
+		return shortSHA(before) + " → " + shortSHA(after)
+	}
+}
+
+func formatMs(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).String()
+}
+
+func formatTokens(tokens int) string {
+	if tokens == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", tokens)
+}
+
+func formatCost(cost float64) string {
+	if cost == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("$%.4f", cost)
+}
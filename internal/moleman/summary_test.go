@@ -0,0 +1,83 @@
+package moleman
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunSummaryKeepsIterationsAndMarksSkipped(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, `version: 1
+
+agents:
+  echo:
+    type: generic
+    command: printf
+  fail:
+    type: generic
+    command: "false"
+
+workflow:
+  - type: loop
+    maxIters: 2
+    until: 'outputs.review == "xx"'
+    body:
+      - type: agent
+        name: review
+        agent: echo
+        input:
+          prompt: "{{ .last }}x"
+        output:
+          toNext: true
+  - type: agent
+    name: check
+    agent: fail
+    input:
+      prompt: "ignored"
+    output:
+      toNext: true
+  - type: agent
+    name: ship
+    agent: echo
+    input:
+      prompt: "done"
+    output:
+      toNext: true
+`)
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	result, err := Run(cfg, configPath, RunOptions{})
+	if err == nil {
+		t.Fatalf("expected run to fail")
+	}
+	raw, err := os.ReadFile(filepath.Join(result.RunDir, "summary.json"))
+	if err != nil {
+		t.Fatalf("read summary: %v", err)
+	}
+	var summary RunSummary
+	if err := json.Unmarshal(raw, &summary); err != nil {
+		t.Fatalf("parse summary: %v", err)
+	}
+
+	want := []struct{ name, status, iteration string }{
+		{"review", "success", "iter-1"},
+		{"review", "success", "iter-2"},
+		{"check", "failed", "iter-"},
+		{"ship", "skipped", "iter-"},
+	}
+	if len(summary.Nodes) != len(want) {
+		t.Fatalf("expected %d nodes, got %+v", len(want), summary.Nodes)
+	}
+	for idx, node := range want {
+		got := summary.Nodes[idx]
+		if got.Name != node.name || got.Status != node.status || iterationLabel(got.Iteration) != node.iteration {
+			t.Fatalf("node %d = %s/%s/%s, want %s/%s/%s", idx, got.Name, got.Status, iterationLabel(got.Iteration), node.name, node.status, node.iteration)
+		}
+	}
+}
@@ -8,13 +8,24 @@ import (
 )
 
 func RenderTemplate(input string, data map[string]any) (string, error) {
+	return renderTemplate(input, data, nil)
+}
+
+// templateFuncs are the functions workflow templates can call. env values of
+// secret-looking variables are added to secrets.
+func templateFuncs(secrets *redactor) template.FuncMap {
+	return template.FuncMap{
+		"shellEscape": shellEscape,
+		"env":         templateEnv(secrets),
+	}
+}
+
+func renderTemplate(input string, data map[string]any, secrets *redactor) (string, error) {
 	if input == "" {
 		return "", nil
 	}
 	tpl, err := template.New("moleman").
-		Funcs(template.FuncMap{
-			"shellEscape": shellEscape,
-		}).
+		Funcs(templateFuncs(secrets)).
 		Option("missingkey=zero").
 		Parse(input)
 	if err != nil {
@@ -0,0 +1,341 @@
+package moleman
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/term"
+)
+
+const (
+	tuiRefreshInterval = 200 * time.Millisecond
+	tuiMaxTailLines    = 500
+	tuiLogLines        = 4
+)
+
+var (
+	tuiPrimary = lipgloss.Color("#c98301")
+	tuiTitle   = lipgloss.NewStyle().Foreground(tuiPrimary).Bold(true)
+	tuiDim     = lipgloss.NewStyle().Foreground(lipgloss.Color("244"))
+	tuiRunning = lipgloss.NewStyle().Foreground(lipgloss.Color("69")).Bold(true)
+	tuiOK      = lipgloss.NewStyle().Foreground(lipgloss.Color("78"))
+	tuiFail    = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true)
+	tuiWarn    = lipgloss.NewStyle().Foreground(lipgloss.Color("220"))
+)
+
+// TUI renders live run progress from the event stream: the workflow tree,
+// loop counters, per-node timings, the last until value and a tail of the
+// active agent's output. Feed it events via Handle (RunOptions.OnEvent).
+type TUI struct {
+	mu      sync.Mutex
+	out     *os.File
+	cfg     *Config
+	started time.Time
+	runID   string
+	status  string
+
+	nodes  map[string]*tuiNode
+	loops  map[string]*tuiLoop
+	active string
+
+	invocations int
+	iterations  int
+	usage       Usage
+
+	tail    []string
+	partial string
+	logs    []string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type tuiNode struct {
+	status   string
+	started  time.Time
+	duration time.Duration
+	runs     int
+}
+
+type tuiLoop struct {
+	iteration int
+	maxIters  int
+	lastValue string
+}
+
+// NewTUI prepares a TUI drawing to out, which must be a terminal.
+func NewTUI(cfg *Config, out *os.File) (*TUI, error) {
+	if !term.IsTerminal(out.Fd()) {
+		return nil, fmt.Errorf("--tui requires a terminal")
+	}
+	return &TUI{
+		out:     out,
+		cfg:     cfg,
+		started: time.Now(),
+		status:  "starting",
+		nodes:   map[string]*tuiNode{},
+		loops:   map[string]*tuiLoop{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Start switches to the alternate screen and redraws until Stop.
+func (t *TUI) Start() {
+	fmt.Fprint(t.out, "\x1b[?1049h\x1b[?25l")
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(tuiRefreshInterval)
+		defer ticker.Stop()
+		for {
+			t.draw()
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop restores the terminal and leaves the final workflow tree on screen.
+func (t *TUI) Stop() {
+	close(t.stop)
+	<-t.done
+	fmt.Fprint(t.out, "\x1b[?25h\x1b[?1049l")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintln(t.out, strings.Join(t.renderTree(t.cfg.Workflow, nil, 0, time.Now()), "\n"))
+	fmt.Fprintln(t.out, t.renderStats())
+}
+
+// LogWriter collects log lines for the TUI's log pane so they do not tear the
+// screen.
+func (t *TUI) LogWriter() io.Writer {
+	return tuiLogWriter{t}
+}
+
+type tuiLogWriter struct {
+	t *TUI
+}
+
+func (w tuiLogWriter) Write(p []byte) (int, error) {
+	w.t.mu.Lock()
+	defer w.t.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.t.logs = append(w.t.logs, line)
+	}
+	if len(w.t.logs) > tuiLogLines {
+		w.t.logs = w.t.logs[len(w.t.logs)-tuiLogLines:]
+	}
+	return len(p), nil
+}
+
+func (t *TUI) Handle(event Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch event.Type {
+	case "run.started":
+		t.runID = event.RunID
+		t.status = "running"
+	case "node.started":
+		node := t.node(event.Node)
+		node.status = "running"
+		node.started = event.Time
+		t.active = event.Node
+		t.invocations++
+		t.tail = nil
+		t.partial = ""
+	case "node.output":
+		text, _ := event.Data["text"].(string)
+		t.appendOutput(text)
+	case "node.finished":
+		node := t.node(event.Node)
+		node.status, _ = event.Data["status"].(string)
+		node.runs++
+		if ms, ok := event.Data["durationMs"].(int64); ok {
+			node.duration = time.Duration(ms) * time.Millisecond
+		}
+		if usage, ok := event.Data["usage"].(*Usage); ok {
+			t.usage.Add(usage)
+		}
+	case "loop.iteration":
+		loop := t.loop(event.Path)
+		loop.iteration, _ = event.Data["iteration"].(int)
+		loop.maxIters, _ = event.Data["maxIters"].(int)
+		t.iterations++
+	case "condition.evaluated":
+		loop := t.loop(event.Path)
+		loop.lastValue = fmt.Sprint(event.Data["value"])
+		if errText, ok := event.Data["error"].(string); ok {
+			loop.lastValue = "error: " + errText
+		}
+	case "run.finished":
+		t.status, _ = event.Data["status"].(string)
+	}
+}
+
+func (t *TUI) node(name string) *tuiNode {
+	node, ok := t.nodes[name]
+	if !ok {
+		node = &tuiNode{}
+		t.nodes[name] = node
+	}
+	return node
+}
+
+func (t *TUI) loop(path string) *tuiLoop {
+	loop, ok := t.loops[path]
+	if !ok {
+		loop = &tuiLoop{}
+		t.loops[path] = loop
+	}
+	return loop
+}
+
+func (t *TUI) appendOutput(text string) {
+	text = strings.ReplaceAll(t.partial+text, "\r", "")
+	lines := strings.Split(text, "\n")
+	t.partial = lines[len(lines)-1]
+	t.tail = append(t.tail, lines[:len(lines)-1]...)
+	if len(t.tail) > tuiMaxTailLines {
+		t.tail = t.tail[len(t.tail)-tuiMaxTailLines:]
+	}
+}
+
+func (t *TUI) draw() {
+	width, height, err := term.GetSize(t.out.Fd())
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	t.mu.Lock()
+	frame := t.render(width, height, time.Now())
+	t.mu.Unlock()
+	fmt.Fprint(t.out, "\x1b[H\x1b[2J"+frame)
+}
+
+func (t *TUI) render(width, height int, now time.Time) string {
+	lines := []string{
+		tuiTitle.Render("moleman") + " " + t.runID + "  " + t.styleStatus(t.status) + "  " +
+			tuiDim.Render("elapsed "+now.Sub(t.started).Round(time.Second).String()),
+		"",
+	}
+	lines = append(lines, t.renderTree(t.cfg.Workflow, nil, 0, now)...)
+
+	lines = append(lines, "", t.renderStats(), "")
+
+	logLines := []string{tuiDim.Render("── log ──")}
+	logLines = append(logLines, t.logs...)
+
+	tailHeader := "── output ──"
+	if t.active != "" {
+		tailHeader = "── " + t.active + " output ──"
+	}
+	lines = append(lines, tuiDim.Render(tailHeader))
+	tail := t.tail
+	if t.partial != "" {
+		tail = append(append([]string(nil), tail...), t.partial)
+	}
+	room := height - len(lines) - len(logLines) - 1
+	if room < 0 {
+		room = 0
+	}
+	if len(tail) > room {
+		tail = tail[len(tail)-room:]
+	}
+	lines = append(lines, tail...)
+	for len(lines) < height-len(logLines) {
+		lines = append(lines, "")
+	}
+	lines = append(lines, logLines...)
+
+	for idx, line := range lines {
+		lines[idx] = ansi.Truncate(line, width, "…")
+	}
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *TUI) renderStats() string {
+	stats := fmt.Sprintf("agents %d · iterations %d", t.invocations, t.iterations)
+	if t.usage.TotalTokens > 0 {
+		stats += fmt.Sprintf(" · tokens %d", t.usage.TotalTokens)
+	}
+	if t.usage.CostUSD > 0 {
+		stats += fmt.Sprintf(" · $%.4f", t.usage.CostUSD)
+	}
+	return tuiDim.Render(stats)
+}
+
+func (t *TUI) renderTree(items []WorkflowItem, location []int, depth int, now time.Time) []string {
+	lines := []string{}
+	indent := strings.Repeat("  ", depth+1)
+	for idx, item := range items {
+		path := append(append([]int(nil), location...), idx)
+		switch item.Type {
+		case "agent":
+			node := t.nodes[item.Name]
+			icon, timing := tuiDim.Render("·"), ""
+			if node != nil {
+				icon = t.statusIcon(node.status)
+				switch {
+				case node.status == "running":
+					timing = tuiRunning.Render(now.Sub(node.started).Round(time.Second).String())
+				case node.duration > 0:
+					timing = tuiDim.Render(node.duration.Round(100 * time.Millisecond).String())
+				}
+				if node.runs > 1 {
+					timing += tuiDim.Render(fmt.Sprintf(" ×%d", node.runs))
+				}
+			}
+			lines = append(lines, fmt.Sprintf("%s%s %s %s  %s", indent, icon, item.Name, tuiDim.Render("("+item.Agent+")"), timing))
+		case "loop":
+			loop := t.loops[workflowPath(path)]
+			counter := fmt.Sprintf("0/%d", item.MaxIters)
+			last := ""
+			if loop != nil {
+				counter = fmt.Sprintf("%d/%d", loop.iteration, item.MaxIters)
+				if loop.lastValue != "" {
+					last = "  last: " + loop.lastValue
+				}
+			}
+			lines = append(lines, fmt.Sprintf("%s%s loop %s %s%s", indent, tuiTitle.Render("↻"), counter, tuiDim.Render("until "+item.Until), last))
+			lines = append(lines, t.renderTree(item.Body, path, depth+1, now)...)
+		}
+	}
+	return lines
+}
+
+func (t *TUI) statusIcon(status string) string {
+	switch status {
+	case "running":
+		return tuiRunning.Render("▶")
+	case "success":
+		return tuiOK.Render("✓")
+	case "failed":
+		return tuiFail.Render("✗")
+	default:
+		return tuiWarn.Render("■")
+	}
+}
+
+func (t *TUI) styleStatus(status string) string {
+	switch status {
+	case "success":
+		return tuiOK.Render(status)
+	case "failed":
+		return tuiFail.Render(status)
+	case "running", "starting":
+		return tuiRunning.Render(status)
+	default:
+		return tuiWarn.Render(status)
+	}
+}
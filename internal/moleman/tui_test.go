@@ -0,0 +1,53 @@
+package moleman
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestTUIRendersProgressFromEvents(t *testing.T) {
+	cfg := &Config{Workflow: []WorkflowItem{
+		{Type: "agent", Name: "write", Agent: "codex"},
+		{Type: "loop", MaxIters: 3, Until: "outputs.review == \"ok\"", Body: []WorkflowItem{
+			{Type: "agent", Name: "review", Agent: "claude"},
+		}},
+	}}
+	tui := &TUI{cfg: cfg, started: time.Now(), nodes: map[string]*tuiNode{}, loops: map[string]*tuiLoop{}}
+
+	now := time.Now()
+	events := []Event{
+		{Type: "run.started", RunID: "run-1"},
+		{Type: "node.started", Node: "write", Time: now},
+		{Type: "node.finished", Node: "write", Data: map[string]any{"status": "success", "durationMs": int64(1500), "usage": &Usage{TotalTokens: 42}}},
+		{Type: "loop.iteration", Path: "workflow[1]", Data: map[string]any{"iteration": 2, "maxIters": 3}},
+		{Type: "condition.evaluated", Path: "workflow[1]", Data: map[string]any{"value": false}},
+		{Type: "node.started", Node: "review", Time: now},
+		{Type: "node.output", Node: "review", Data: map[string]any{"stream": "stdout", "text": "line one\nline tw"}},
+		{Type: "node.output", Node: "review", Data: map[string]any{"stream": "stdout", "text": "o\n"}},
+	}
+	for _, event := range events {
+		tui.Handle(event)
+	}
+
+	screen := ansi.Strip(tui.render(120, 30, now))
+	for _, want := range []string{
+		"run-1",
+		"✓ write (codex)  1.5s",
+		"loop 2/3 until outputs.review == \"ok\"  last: false",
+		"▶ review (claude)",
+		"agents 2 · iterations 1 · tokens 42",
+		"── review output ──",
+		"line one",
+		"line two",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Fatalf("screen missing %q:\n%s", want, screen)
+		}
+	}
+	if lines := strings.Count(screen, "\n") + 1; lines != 30 {
+		t.Fatalf("expected frame to fill 30 lines, got %d", lines)
+	}
+}
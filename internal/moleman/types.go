@@ -1,25 +1,55 @@
 package moleman
 
 type Config struct {
-	Version  int                    `yaml:"version"`
-	Agents   map[string]AgentConfig `yaml:"agents"`
-	Workflow []WorkflowItem         `yaml:"workflow"`
+	Version    int                       `yaml:"version"`
+	AgentsFile string                    `yaml:"agentsFile,omitempty"`
+	Params     map[string]ParamSpec      `yaml:"params,omitempty"`
+	Agents     map[string]AgentConfig    `yaml:"agents"`
+	Limits     LimitsSpec                `yaml:"limits,omitempty"`
+	Redact     []string                  `yaml:"redact,omitempty"`
+	Profiles   map[string]ProfileSpec    `yaml:"profiles,omitempty"`
+	Workflow   []WorkflowItem            `yaml:"workflow,omitempty"`
+	Workflows  map[string][]WorkflowItem `yaml:"workflows,omitempty"`
+
+	// configAgents are the agents as declared in the config itself, before
+	// merging with agents files.
+	configAgents map[string]AgentConfig
+	// agentSources records where each resolved agent field came from.
+	agentSources map[string]map[string]string
+	// paramValues are the resolved params, exposed to templates as .params.
+	paramValues map[string]any
+	// profile is the profile applied at load, if any.
+	profile string
+	// workflowName is the entry of Workflows selected at load, if any; the
+	// workflow: block is then kept in defaultWorkflow.
+	workflowName    string
+	defaultWorkflow []WorkflowItem
+}
+
+type LimitsSpec struct {
+	Timeout             string  `yaml:"timeout,omitempty"`
+	MaxAgentInvocations int     `yaml:"maxAgentInvocations,omitempty"`
+	MaxTotalIterations  int     `yaml:"maxTotalIterations,omitempty"`
+	MaxCostUSD          float64 `yaml:"maxCostUSD,omitempty"`
 }
 
 type AgentConfig struct {
-	Extends string            `yaml:"extends,omitempty"`
-	Type    string            `yaml:"type"`
-	Command string            `yaml:"command,omitempty"`
-	Model   string            `yaml:"model,omitempty"`
-	Thinking string           `yaml:"thinking,omitempty"`
-	Args    []string          `yaml:"args,omitempty"`
-	OutputSchema string       `yaml:"outputSchema,omitempty"`
-	OutputFile   string       `yaml:"outputFile,omitempty"`
-	Env     map[string]string `yaml:"env,omitempty"`
-	Timeout string            `yaml:"timeout,omitempty"`
-	Capture []string          `yaml:"capture,omitempty"`
-	Print   []string          `yaml:"print,omitempty"`
-	Session *SessionSpec      `yaml:"session,omitempty"`
+	Extends      string              `yaml:"extends,omitempty"`
+	Type         string              `yaml:"type"`
+	Command      string              `yaml:"command,omitempty"`
+	Run          string              `yaml:"run,omitempty"`
+	Model        string              `yaml:"model,omitempty"`
+	Thinking     string              `yaml:"thinking,omitempty"`
+	Args         []string            `yaml:"args,omitempty"`
+	ArgsAppend   []string            `yaml:"argsAppend,omitempty"`
+	OutputSchema string              `yaml:"outputSchema,omitempty"`
+	OutputFile   string              `yaml:"outputFile,omitempty"`
+	Env          map[string]EnvValue `yaml:"env,omitempty"`
+	EnvUnset     []string            `yaml:"envUnset,omitempty"`
+	Timeout      string              `yaml:"timeout,omitempty"`
+	Capture      []string            `yaml:"capture,omitempty"`
+	Print        []string            `yaml:"print,omitempty"`
+	Session      *SessionSpec        `yaml:"session,omitempty"`
 }
 
 type WorkflowItem struct {
@@ -44,6 +74,8 @@ type OutputSpec struct {
 	ToNext bool   `yaml:"toNext,omitempty"`
 	File   string `yaml:"file,omitempty"`
 	Stdout bool   `yaml:"stdout,omitempty"`
+	// Type is text or json; only version 2 configs set it.
+	Type string `yaml:"-"`
 }
 
 type SessionSpec struct {
@@ -0,0 +1,203 @@
+package moleman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Usage is the token and cost accounting reported by an agent CLI. Fields the
+// agent does not report stay zero.
+type Usage struct {
+	InputTokens      int     `json:"inputTokens"`
+	OutputTokens     int     `json:"outputTokens"`
+	CacheReadTokens  int     `json:"cacheReadTokens,omitempty"`
+	CacheWriteTokens int     `json:"cacheWriteTokens,omitempty"`
+	ReasoningTokens  int     `json:"reasoningTokens,omitempty"`
+	TotalTokens      int     `json:"totalTokens"`
+	CostUSD          float64 `json:"costUSD,omitempty"`
+}
+
+func (u *Usage) Add(other *Usage) {
+	if other == nil {
+		return
+	}
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheReadTokens += other.CacheReadTokens
+	u.CacheWriteTokens += other.CacheWriteTokens
+	u.ReasoningTokens += other.ReasoningTokens
+	u.TotalTokens += other.TotalTokens
+	u.CostUSD += other.CostUSD
+}
+
+func parseUsageFromLogs(agentType, stdoutPath, stderrPath string) *Usage {
+	if agentType != "claude" && agentType != "codex" {
+		return nil
+	}
+	stdout, _ := os.ReadFile(stdoutPath)
+	stderr, _ := os.ReadFile(stderrPath)
+	return parseUsage(agentType, stdout, stderr)
+}
+
+func parseUsage(agentType string, stdout, stderr []byte) *Usage {
+	switch agentType {
+	case "claude":
+		return parseClaudeUsage(stdout)
+	case "codex":
+		return parseCodexUsage(stdout, stderr)
+	default:
+		return nil
+	}
+}
+
+type claudeResult struct {
+	Type         string   `json:"type"`
+	TotalCostUSD *float64 `json:"total_cost_usd"`
+	CostUSD      *float64 `json:"cost_usd"`
+	Usage        *struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	} `json:"usage"`
+}
+
+// parseClaudeUsage reads the result object of `--output-format json`, or the
+// final `result` event of `--output-format stream-json`.
+func parseClaudeUsage(stdout []byte) *Usage {
+	var result *claudeResult
+	var whole claudeResult
+	if err := json.Unmarshal(stdout, &whole); err == nil {
+		result = &whole
+	} else {
+		for _, line := range jsonLines(stdout) {
+			var event claudeResult
+			if err := json.Unmarshal(line, &event); err != nil {
+				continue
+			}
+			if event.Type == "result" {
+				result = &event
+			}
+		}
+	}
+	if result == nil || (result.Usage == nil && result.TotalCostUSD == nil && result.CostUSD == nil) {
+		return nil
+	}
+	usage := &Usage{}
+	if result.Usage != nil {
+		usage.InputTokens = result.Usage.InputTokens
+		usage.OutputTokens = result.Usage.OutputTokens
+		usage.CacheReadTokens = result.Usage.CacheReadInputTokens
+		usage.CacheWriteTokens = result.Usage.CacheCreationInputTokens
+		usage.TotalTokens = usage.InputTokens + usage.OutputTokens + usage.CacheReadTokens + usage.CacheWriteTokens
+	}
+	switch {
+	case result.TotalCostUSD != nil:
+		usage.CostUSD = *result.TotalCostUSD
+	case result.CostUSD != nil:
+		usage.CostUSD = *result.CostUSD
+	}
+	return usage
+}
+
+type codexTokenCounts struct {
+	InputTokens           int `json:"input_tokens"`
+	CachedInputTokens     int `json:"cached_input_tokens"`
+	OutputTokens          int `json:"output_tokens"`
+	ReasoningOutputTokens int `json:"reasoning_output_tokens"`
+	TotalTokens           int `json:"total_tokens"`
+}
+
+func (c codexTokenCounts) usage() *Usage {
+	total := c.TotalTokens
+	if total == 0 {
+		total = c.InputTokens + c.OutputTokens
+	}
+	return &Usage{
+		InputTokens:     c.InputTokens,
+		OutputTokens:    c.OutputTokens,
+		CacheReadTokens: c.CachedInputTokens,
+		ReasoningTokens: c.ReasoningOutputTokens,
+		TotalTokens:     total,
+	}
+}
+
+var codexTokensUsedPattern = regexp.MustCompile(`(?i)tokens used:?\s*([0-9][0-9,]*)`)
+
+// parseCodexUsage understands `codex exec --json` events (`turn.completed`
+// with usage, or legacy `token_count` messages) and falls back to the
+// "tokens used" line Codex prints in text mode.
+func parseCodexUsage(stdout, stderr []byte) *Usage {
+	var turns *Usage
+	var latestCount *Usage
+	for _, line := range jsonLines(stdout) {
+		var event struct {
+			Type  string            `json:"type"`
+			Usage *codexTokenCounts `json:"usage"`
+			Msg   *struct {
+				Type string `json:"type"`
+				codexTokenCounts
+				Info *struct {
+					TotalTokenUsage *codexTokenCounts `json:"total_token_usage"`
+				} `json:"info"`
+			} `json:"msg"`
+		}
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+		switch {
+		case event.Type == "turn.completed" && event.Usage != nil:
+			if turns == nil {
+				turns = &Usage{}
+			}
+			turns.Add(event.Usage.usage())
+		case event.Msg != nil && event.Msg.Type == "token_count":
+			if event.Msg.Info != nil && event.Msg.Info.TotalTokenUsage != nil {
+				latestCount = event.Msg.Info.TotalTokenUsage.usage()
+			} else {
+				latestCount = event.Msg.codexTokenCounts.usage()
+			}
+		}
+	}
+	if turns != nil {
+		return turns
+	}
+	if latestCount != nil {
+		return latestCount
+	}
+
+	var total string
+	for _, text := range [][]byte{stdout, stderr} {
+		matches := codexTokensUsedPattern.FindAllSubmatch(text, -1)
+		if len(matches) > 0 {
+			total = string(matches[len(matches)-1][1])
+		}
+	}
+	if total == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(strings.ReplaceAll(total, ",", ""))
+	if err != nil {
+		return nil
+	}
+	return &Usage{TotalTokens: parsed}
+}
+
+func jsonLines(data []byte) [][]byte {
+	lines := [][]byte{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		lines = append(lines, append([]byte(nil), line...))
+	}
+	return lines
+}
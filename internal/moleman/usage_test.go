@@ -0,0 +1,71 @@
+package moleman
+
+import "testing"
+
+func TestParseClaudeUsage(t *testing.T) {
+	stdout := []byte(`{"type":"result","session_id":"abc","total_cost_usd":0.0425,"usage":{"input_tokens":10,"output_tokens":200,"cache_read_input_tokens":1000,"cache_creation_input_tokens":50}}`)
+	usage := parseUsage("claude", stdout, nil)
+	if usage == nil {
+		t.Fatalf("expected usage")
+	}
+	if usage.InputTokens != 10 || usage.OutputTokens != 200 || usage.CacheReadTokens != 1000 || usage.CacheWriteTokens != 50 {
+		t.Fatalf("unexpected token counts: %+v", usage)
+	}
+	if usage.TotalTokens != 1260 {
+		t.Fatalf("unexpected total: %d", usage.TotalTokens)
+	}
+	if usage.CostUSD != 0.0425 {
+		t.Fatalf("unexpected cost: %v", usage.CostUSD)
+	}
+}
+
+func TestParseClaudeUsageStreamJSON(t *testing.T) {
+	stdout := []byte("{\"type\":\"system\"}\n{\"type\":\"assistant\"}\n{\"type\":\"result\",\"total_cost_usd\":1.5,\"usage\":{\"input_tokens\":3,\"output_tokens\":4}}\n")
+	usage := parseUsage("claude", stdout, nil)
+	if usage == nil || usage.CostUSD != 1.5 || usage.TotalTokens != 7 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestParseCodexUsage(t *testing.T) {
+	cases := []struct {
+		name   string
+		stdout string
+		stderr string
+		want   Usage
+	}{
+		{
+			name:   "json events",
+			stdout: "{\"type\":\"thread.started\"}\n{\"type\":\"turn.completed\",\"usage\":{\"input_tokens\":100,\"cached_input_tokens\":40,\"output_tokens\":25}}\n",
+			want:   Usage{InputTokens: 100, CacheReadTokens: 40, OutputTokens: 25, TotalTokens: 125},
+		},
+		{
+			name:   "legacy token_count",
+			stdout: "{\"id\":\"0\",\"msg\":{\"type\":\"token_count\",\"input_tokens\":5,\"output_tokens\":6,\"total_tokens\":11}}\n",
+			want:   Usage{InputTokens: 5, OutputTokens: 6, TotalTokens: 11},
+		},
+		{
+			name:   "text mode",
+			stderr: "[2025-01-01T00:00:00] tokens used: 12,345\n",
+			want:   Usage{TotalTokens: 12345},
+		},
+	}
+	for _, tc := range cases {
+		usage := parseUsage("codex", []byte(tc.stdout), []byte(tc.stderr))
+		if usage == nil {
+			t.Fatalf("%s: expected usage", tc.name)
+		}
+		if *usage != tc.want {
+			t.Fatalf("%s: got %+v, want %+v", tc.name, *usage, tc.want)
+		}
+	}
+}
+
+func TestParseUsageMissing(t *testing.T) {
+	if usage := parseUsage("claude", []byte("plain text"), nil); usage != nil {
+		t.Fatalf("expected nil usage, got %+v", usage)
+	}
+	if usage := parseUsage("generic", []byte(`{"usage":{}}`), nil); usage != nil {
+		t.Fatalf("expected nil usage for generic, got %+v", usage)
+	}
+}
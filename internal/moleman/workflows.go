@@ -0,0 +1,150 @@
+package moleman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// defaultWorkflowName names the workflow: block in run IDs and listings.
+const defaultWorkflowName = "workflow"
+
+var workflowNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// selectWorkflow makes the named entry of workflows the one to run. An empty
+// name keeps workflow:, or picks the only entry of workflows when there is
+// no workflow: block.
+func selectWorkflow(cfg *Config, name string) error {
+	if name == "" || name == defaultWorkflowName {
+		if len(cfg.Workflow) > 0 || len(cfg.Workflows) != 1 {
+			if len(cfg.Workflow) == 0 && len(cfg.Workflows) > 1 {
+				return fmt.Errorf("config has no default workflow; pick one of %s", joinOr(sortedKeys(cfg.Workflows)))
+			}
+			return nil
+		}
+		name = sortedKeys(cfg.Workflows)[0]
+	}
+	items, ok := cfg.Workflows[name]
+	if !ok {
+		return fmt.Errorf("unknown workflow: %s (want %s)", name, joinOr(WorkflowNames(cfg)))
+	}
+	cfg.workflowName = name
+	cfg.defaultWorkflow = cfg.Workflow
+	cfg.Workflow = items
+	return nil
+}
+
+// WorkflowNames lists the workflows a config can run, the workflow: block
+// first as "workflow".
+func WorkflowNames(cfg *Config) []string {
+	names := []string{}
+	for _, set := range workflowSets(cfg) {
+		names = append(names, set.name)
+	}
+	return names
+}
+
+// WorkflowName is the name of the workflow selected at load.
+func WorkflowName(cfg *Config) string {
+	if cfg.workflowName == "" {
+		return defaultWorkflowName
+	}
+	return cfg.workflowName
+}
+
+type workflowSet struct {
+	name  string
+	path  string
+	items []WorkflowItem
+}
+
+// workflowSets returns the workflow: block and every entry of workflows.
+func workflowSets(cfg *Config) []workflowSet {
+	sets := []workflowSet{}
+	defaultItems := cfg.Workflow
+	if cfg.workflowName != "" {
+		defaultItems = cfg.defaultWorkflow
+	}
+	if len(defaultItems) > 0 {
+		sets = append(sets, workflowSet{name: defaultWorkflowName, path: "workflow", items: defaultItems})
+	}
+	for _, name := range sortedKeys(cfg.Workflows) {
+		sets = append(sets, workflowSet{name: name, path: "workflows." + name, items: cfg.Workflows[name]})
+	}
+	return sets
+}
+
+// validateWorkflowSets validates every workflow, each with its own node
+// names, reporting errors at their workflows.NAME path.
+func validateWorkflowSets(cfg *Config) error {
+	for _, name := range sortedKeys(cfg.Workflows) {
+		if !workflowNamePattern.MatchString(name) || name == defaultWorkflowName {
+			return configErrorf("workflows."+name, "is not a valid workflow name")
+		}
+		if len(cfg.Workflows[name]) == 0 {
+			return configErrorf("workflows."+name, "is empty")
+		}
+	}
+	for _, set := range workflowSets(cfg) {
+		if err := validateWorkflow(cfg, set.items, nil, map[string]bool{}); err != nil {
+			return rebaseWorkflowError(err, set.path)
+		}
+	}
+	return nil
+}
+
+func rebaseWorkflowError(err error, path string) error {
+	var configErr *ConfigError
+	if path != "workflow" && errors.As(err, &configErr) && strings.HasPrefix(configErr.Path, "workflow") {
+		configErr.Path = path + strings.TrimPrefix(configErr.Path, "workflow")
+	}
+	return err
+}
+
+// WorkflowInfo describes one workflow of a config for listings.
+type WorkflowInfo struct {
+	Name     string   `json:"name"`
+	Selected bool     `json:"selected,omitempty"`
+	Nodes    int      `json:"nodes"`
+	Agents   []string `json:"agents"`
+}
+
+// PrintWorkflows lists the config's workflows as text or json.
+func PrintWorkflows(w io.Writer, cfg *Config, format string) error {
+	infos := []WorkflowInfo{}
+	for _, set := range workflowSets(cfg) {
+		info := WorkflowInfo{Name: set.name, Selected: set.name == WorkflowName(cfg), Agents: []string{}}
+		seen := map[string]bool{}
+		for _, item := range flattenAgentNodes(set.items) {
+			info.Nodes++
+			if !seen[item.Agent] {
+				seen[item.Agent] = true
+				info.Agents = append(info.Agents, item.Agent)
+			}
+		}
+		infos = append(infos, info)
+	}
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(infos)
+	case "", "text":
+	default:
+		return fmt.Errorf("unknown workflows format: %s (want text or json)", format)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKFLOW\tNODES\tAGENTS")
+	for _, info := range infos {
+		name := info.Name
+		if info.Selected {
+			name += " *"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", name, info.Nodes, strings.Join(info.Agents, ", "))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,94 @@
+package moleman
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const namedWorkflowsConfig = `version: 1
+
+agents:
+  echo:
+    type: generic
+    command: "printf"
+    capture: [stdout]
+
+workflow:
+  - type: agent
+    name: implement
+    agent: echo
+    input:
+      prompt: "implement"
+    output:
+      toNext: true
+
+workflows:
+  review-only:
+    - type: agent
+      name: implement
+      agent: echo
+      input:
+        prompt: "review"
+      output:
+        toNext: true
+`
+
+func TestLoadConfigSelectsNamedWorkflow(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, namedWorkflowsConfig)
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if WorkflowName(cfg) != "workflow" || cfg.Workflow[0].Input.Prompt != "implement" {
+		t.Fatalf("expected default workflow, got %s", WorkflowName(cfg))
+	}
+
+	cfg, err = LoadConfigWithOptions(configPath, LoadOptions{Workflow: "review-only"})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if WorkflowName(cfg) != "review-only" || cfg.Workflow[0].Input.Prompt != "review" {
+		t.Fatalf("expected review-only workflow, got %s", WorkflowName(cfg))
+	}
+	if got := strings.Join(WorkflowNames(cfg), ","); got != "workflow,review-only" {
+		t.Fatalf("unexpected workflow names: %s", got)
+	}
+
+	var out bytes.Buffer
+	if err := PrintWorkflows(&out, cfg, "text"); err != nil {
+		t.Fatalf("print workflows: %v", err)
+	}
+	if !strings.Contains(out.String(), "review-only *  1      echo") {
+		t.Fatalf("unexpected listing:\n%s", out.String())
+	}
+
+	result, err := Run(cfg, configPath, RunOptions{Workdir: tempDir})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if !strings.HasSuffix(result.RunDir, "-review-only") {
+		t.Fatalf("expected run dir named after the workflow, got %s", result.RunDir)
+	}
+
+	if _, err := LoadConfigWithOptions(configPath, LoadOptions{Workflow: "fix-ci"}); err == nil || !strings.Contains(err.Error(), "unknown workflow: fix-ci (want workflow or review-only)") {
+		t.Fatalf("expected unknown workflow error, got %v", err)
+	}
+}
+
+func TestValidateConfigReportsNamedWorkflowPaths(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "moleman.yaml")
+	writeFile(t, configPath, strings.Replace(namedWorkflowsConfig, "      agent: echo\n      input:\n        prompt: \"review\"", "      agent: missing\n      input:\n        prompt: \"review\"", 1))
+
+	_, err := LoadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "moleman.yaml:22:7: workflows.review-only[0].agent references unknown agent: missing") {
+		t.Fatalf("expected positioned error in named workflow, got %v", err)
+	}
+}
@@ -0,0 +1,382 @@
+package moleman
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v3"
+)
+
+const workflowTestSuffix = ".moleman-test.yaml"
+
+// WorkflowTestFile is a *.moleman-test.yaml file: a workflow config plus
+// cases that run it against mocked agents.
+type WorkflowTestFile struct {
+	Config   string             `yaml:"config,omitempty"`
+	Workflow string             `yaml:"workflow,omitempty"`
+	Tests    []WorkflowTestCase `yaml:"tests"`
+}
+
+type WorkflowTestCase struct {
+	Name   string         `yaml:"name"`
+	Prompt string         `yaml:"prompt,omitempty"`
+	Mocks  []MockResponse `yaml:"mocks"`
+	Expect WorkflowExpect `yaml:"expect,omitempty"`
+}
+
+// MockResponse is the scripted result of an agent node. Iteration (e.g. "2"
+// or "2-1" for nested loops) and Prompt (a regexp over the rendered input)
+// narrow the match; the first matching mock wins.
+type MockResponse struct {
+	Node      string `yaml:"node"`
+	Iteration string `yaml:"iteration,omitempty"`
+	Prompt    string `yaml:"prompt,omitempty"`
+	Stdout    string `yaml:"stdout,omitempty"`
+	Stderr    string `yaml:"stderr,omitempty"`
+	ExitCode  int    `yaml:"exitCode,omitempty"`
+}
+
+type WorkflowExpect struct {
+	Status string         `yaml:"status,omitempty"`
+	Nodes  []string       `yaml:"nodes,omitempty"`
+	Loops  map[string]int `yaml:"loops,omitempty"`
+	Output *TextExpect    `yaml:"output,omitempty"`
+	Files  []FileExpect   `yaml:"files,omitempty"`
+}
+
+type TextExpect struct {
+	Equals   string `yaml:"equals,omitempty"`
+	Contains string `yaml:"contains,omitempty"`
+	Matches  string `yaml:"matches,omitempty"`
+}
+
+// FileExpect asserts a file exists after the run. Relative paths are resolved
+// against the workflow's workdir.
+type FileExpect struct {
+	Path     string `yaml:"path"`
+	Contains string `yaml:"contains,omitempty"`
+}
+
+type WorkflowTestResult struct {
+	File     string
+	Name     string
+	Duration time.Duration
+	Failures []string
+}
+
+func (r WorkflowTestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// FindWorkflowTests expands files and directories into *.moleman-test.yaml
+// paths. Directories are searched recursively, skipping .git and .moleman.
+func FindWorkflowTests(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	found := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("test path: %w", err)
+		}
+		if !info.IsDir() {
+			found = append(found, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(current string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if current != path && (entry.Name() == ".git" || entry.Name() == ".moleman") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(entry.Name(), workflowTestSuffix) {
+				found = append(found, current)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("find tests: %w", err)
+		}
+	}
+	return found, nil
+}
+
+func LoadWorkflowTestFile(path string) (*WorkflowTestFile, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read test file: %w", err)
+	}
+	file := &WorkflowTestFile{}
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(file.Tests) == 0 {
+		return nil, fmt.Errorf("%s has no tests", path)
+	}
+	for idx, test := range file.Tests {
+		if test.Name == "" {
+			return nil, fmt.Errorf("%s tests[%d] missing name", path, idx)
+		}
+		for mockIdx, mock := range test.Mocks {
+			if mock.Node == "" {
+				return nil, fmt.Errorf("%s test %s mocks[%d] missing node", path, test.Name, mockIdx)
+			}
+		}
+	}
+	return file, nil
+}
+
+// RunWorkflowTests runs every case in a test file. The returned error is for
+// files that cannot be loaded; failed assertions are reported per result.
+func RunWorkflowTests(path string) ([]WorkflowTestResult, error) {
+	file, err := LoadWorkflowTestFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfgPath := file.Config
+	if cfgPath == "" {
+		cfgPath = "moleman.yaml"
+	}
+	if !filepath.IsAbs(cfgPath) {
+		cfgPath = filepath.Join(filepath.Dir(path), cfgPath)
+	}
+	cfg, err := LoadConfigWithOptions(cfgPath, LoadOptions{Workflow: file.Workflow})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	workdir := ConfigDir(cfgPath)
+	if workdir == "" {
+		workdir = "."
+	}
+
+	results := []WorkflowTestResult{}
+	for _, test := range file.Tests {
+		result, err := runWorkflowTestCase(cfg, cfgPath, workdir, test)
+		if err != nil {
+			return nil, fmt.Errorf("%s test %s: %w", path, test.Name, err)
+		}
+		result.File = path
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func runWorkflowTestCase(cfg *Config, cfgPath, workdir string, test WorkflowTestCase) (WorkflowTestResult, error) {
+	runsDir, err := os.MkdirTemp("", "moleman-test-")
+	if err != nil {
+		return WorkflowTestResult{}, fmt.Errorf("create runs dir: %w", err)
+	}
+	defer os.RemoveAll(runsDir)
+
+	observed := newWorkflowObservation()
+	written := &writtenFiles{saved: map[string]*[]byte{}}
+	defer written.restore()
+	mocks := test.Mocks
+	if mocks == nil {
+		mocks = []MockResponse{}
+	}
+	started := time.Now()
+	_, runErr := Run(cfg, cfgPath, RunOptions{
+		Prompt:      test.Prompt,
+		Workdir:     workdir,
+		RunsDir:     runsDir,
+		Mocks:       mocks,
+		OnEvent:     observed.handle,
+		BeforeWrite: written.save,
+		Stdout:      io.Discard,
+		Stderr:      io.Discard,
+	})
+	result := WorkflowTestResult{Name: test.Name, Duration: time.Since(started)}
+	result.Failures = checkWorkflowExpect(test.Expect, observed, runErr, workdir)
+	return result, nil
+}
+
+// writtenFiles remembers what output files held before a test case wrote
+// them, so no case leaves files behind for the user or for later cases.
+type writtenFiles struct {
+	order []string
+	saved map[string]*[]byte
+}
+
+func (w *writtenFiles) save(path string) {
+	if _, ok := w.saved[path]; ok {
+		return
+	}
+	w.order = append(w.order, path)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		w.saved[path] = nil
+		return
+	}
+	w.saved[path] = &raw
+}
+
+func (w *writtenFiles) restore() {
+	for idx := len(w.order) - 1; idx >= 0; idx-- {
+		path := w.order[idx]
+		var err error
+		if raw := w.saved[path]; raw != nil {
+			err = os.WriteFile(path, *raw, 0o644)
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			log.Warn("restore test output file", "path", path, "err", err)
+		}
+	}
+}
+
+// workflowObservation collects what a test run did from its event stream.
+type workflowObservation struct {
+	nodes   []string
+	loops   map[string]int
+	output  string
+	current strings.Builder
+}
+
+func newWorkflowObservation() *workflowObservation {
+	return &workflowObservation{loops: map[string]int{}}
+}
+
+func (o *workflowObservation) handle(event Event) {
+	switch event.Type {
+	case "node.started":
+		o.current.Reset()
+	case "node.output":
+		if event.Data["stream"] == "stdout" {
+			text, _ := event.Data["text"].(string)
+			o.current.WriteString(text)
+		}
+	case "node.finished":
+		o.nodes = append(o.nodes, event.Node)
+		o.output = o.current.String()
+	case "loop.iteration":
+		iteration, _ := event.Data["iteration"].(int)
+		o.loops[event.Path] = iteration
+	}
+}
+
+func checkWorkflowExpect(expect WorkflowExpect, observed *workflowObservation, runErr error, workdir string) []string {
+	failures := []string{}
+	wantStatus := expect.Status
+	if wantStatus == "" {
+		wantStatus = "success"
+	}
+	if status := runStatus(runErr); status != wantStatus {
+		failure := fmt.Sprintf("status: got %s, want %s", status, wantStatus)
+		if runErr != nil {
+			failure += fmt.Sprintf(" (%v)", runErr)
+		}
+		failures = append(failures, failure)
+	}
+	if expect.Nodes != nil && strings.Join(observed.nodes, ",") != strings.Join(expect.Nodes, ",") {
+		failures = append(failures, fmt.Sprintf("nodes: got [%s], want [%s]", strings.Join(observed.nodes, " "), strings.Join(expect.Nodes, " ")))
+	}
+	for path, want := range expect.Loops {
+		if got := observed.loops[path]; got != want {
+			failures = append(failures, fmt.Sprintf("loop %s: stopped at iteration %d, want %d", path, got, want))
+		}
+	}
+	if expect.Output != nil {
+		failures = append(failures, checkText("output", observed.output, *expect.Output)...)
+	}
+	for _, file := range expect.Files {
+		path := file.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workdir, path)
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("file %s: %v", file.Path, err))
+			continue
+		}
+		if file.Contains != "" && !strings.Contains(string(raw), file.Contains) {
+			failures = append(failures, fmt.Sprintf("file %s: does not contain %q", file.Path, file.Contains))
+		}
+	}
+	return failures
+}
+
+func checkText(label, got string, expect TextExpect) []string {
+	failures := []string{}
+	if expect.Equals != "" && strings.TrimSpace(got) != strings.TrimSpace(expect.Equals) {
+		failures = append(failures, fmt.Sprintf("%s: got %q, want %q", label, got, expect.Equals))
+	}
+	if expect.Contains != "" && !strings.Contains(got, expect.Contains) {
+		failures = append(failures, fmt.Sprintf("%s: %q does not contain %q", label, got, expect.Contains))
+	}
+	if expect.Matches != "" {
+		re, err := regexp.Compile(expect.Matches)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: invalid matches pattern: %v", label, err))
+		} else if !re.MatchString(got) {
+			failures = append(failures, fmt.Sprintf("%s: %q does not match %q", label, got, expect.Matches))
+		}
+	}
+	return failures
+}
+
+// mockSet serves scripted node results in place of agent invocations.
+type mockSet struct {
+	mocks   []MockResponse
+	prompts []*regexp.Regexp
+}
+
+func newMockSet(mocks []MockResponse) (*mockSet, error) {
+	set := &mockSet{mocks: mocks, prompts: make([]*regexp.Regexp, len(mocks))}
+	for idx, mock := range mocks {
+		if mock.Prompt == "" {
+			continue
+		}
+		re, err := regexp.Compile(mock.Prompt)
+		if err != nil {
+			return nil, fmt.Errorf("mock %s prompt: %w", mock.Node, err)
+		}
+		set.prompts[idx] = re
+	}
+	return set, nil
+}
+
+func (s *mockSet) match(node string, iteration []int, input string) (MockResponse, bool) {
+	label := strings.TrimPrefix(iterationLabel(iteration), "iter-")
+	for idx, mock := range s.mocks {
+		if mock.Node != node {
+			continue
+		}
+		if mock.Iteration != "" && mock.Iteration != label {
+			continue
+		}
+		if s.prompts[idx] != nil && !s.prompts[idx].MatchString(input) {
+			continue
+		}
+		return mock, true
+	}
+	return MockResponse{}, false
+}
+
+func mockCommand(ctx *RunContext, nodeName, agentName string, agent AgentConfig, stepDir, input string) (*commandOutput, error) {
+	mock, ok := ctx.Mocks.match(nodeName, ctx.Iteration, input)
+	if !ok {
+		if len(ctx.Iteration) > 0 {
+			return nil, fmt.Errorf("no mock for node %s (iteration %s)", nodeName, strings.TrimPrefix(iterationLabel(ctx.Iteration), "iter-"))
+		}
+		return nil, fmt.Errorf("no mock for node %s", nodeName)
+	}
+	log.Debug("node mock", "node", nodeName, "exit", mock.ExitCode)
+	return cannedCommand(ctx, nodeName, agentName, agent, stepDir, "mock "+nodeName, []byte(mock.Stdout), []byte(mock.Stderr), mock.ExitCode)
+}
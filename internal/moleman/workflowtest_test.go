@@ -0,0 +1,119 @@
+package moleman
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunWorkflowTestsWithMocks(t *testing.T) {
+	tempDir := t.TempDir()
+	config := `version: 1
+
+agents:
+  missing:
+    type: generic
+    command: "moleman-test-no-such-command"
+
+workflow:
+  - type: loop
+    maxIters: 3
+    until: "outputs.review == \"LGTM\""
+    body:
+      - type: agent
+        name: write
+        agent: missing
+        input:
+          prompt: "write {{ .input.prompt }}"
+        output:
+          toNext: true
+      - type: agent
+        name: review
+        agent: missing
+        input:
+          from: write
+        output:
+          toNext: true
+  - type: agent
+    name: save
+    agent: missing
+    input:
+      from: review
+    output:
+      file: "` + filepath.Join(tempDir, "review.txt") + `"
+`
+	tests := `tests:
+  - name: stops after second review
+    prompt: "docs"
+    mocks:
+      - node: write
+        prompt: "^write docs$"
+        stdout: "draft"
+      - node: review
+        iteration: 2
+        stdout: "LGTM"
+      - node: review
+        stdout: "needs work"
+      - node: save
+        stdout: "saved review"
+    expect:
+      nodes: [write, review, write, review, save]
+      loops:
+        workflow[0]: 2
+      output:
+        contains: "saved"
+      files:
+        - path: review.txt
+          contains: "saved review"
+  - name: wrong expectations
+    mocks:
+      - node: write
+        stdout: "draft"
+      - node: review
+        exitCode: 1
+    expect:
+      loops:
+        workflow[0]: 1
+      files:
+        - path: review.txt
+`
+	writeFile(t, filepath.Join(tempDir, "moleman.yaml"), config)
+	writeFile(t, filepath.Join(tempDir, "agents.yaml"), "agents: {}\n")
+	testPath := filepath.Join(tempDir, "loop.moleman-test.yaml")
+	writeFile(t, testPath, tests)
+
+	files, err := FindWorkflowTests([]string{tempDir})
+	if err != nil || len(files) != 1 || files[0] != testPath {
+		t.Fatalf("expected to find %s, got %v (%v)", testPath, files, err)
+	}
+	results, err := RunWorkflowTests(testPath)
+	if err != nil {
+		t.Fatalf("run tests: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if !results[0].Passed() {
+		t.Fatalf("expected first test to pass, got %v", results[0].Failures)
+	}
+	if results[1].Passed() || !strings.Contains(results[1].Failures[0], "status: got failed, want success") {
+		t.Fatalf("expected status failure, got %v", results[1].Failures)
+	}
+	if failures := strings.Join(results[1].Failures, "\n"); !strings.Contains(failures, "file review.txt") {
+		t.Fatalf("expected the first case's review.txt to be gone, got %v", results[1].Failures)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "review.txt")); !os.IsNotExist(err) {
+		t.Fatalf("test cases should not leave output files behind")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, ".moleman")); !os.IsNotExist(err) {
+		t.Fatalf("test runs should not write to the project runs dir")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
@@ -30,12 +35,19 @@ func main() {
 			explainCommand(),
 			initCommand(),
 			doctorCommand(),
+			testCommand(),
+			schemaCommand(),
+			migrateCommand(),
+			runsCommand(),
 			versionCommand(),
 		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
 		log.Error(err.Error())
+		if errors.Is(err, moleman.ErrCancelled) {
+			os.Exit(130)
+		}
 		os.Exit(1)
 	}
 }
@@ -44,7 +56,7 @@ func runCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "run",
 		Usage:     "Execute the workflow",
-		UsageText: "moleman run [flags]\n\nExamples:\n  moleman run --prompt \"Fix the lint errors\"\n  moleman run --config ./moleman.yaml --prompt-file ./prompt.md",
+		UsageText: "moleman run [flags] [workflow]\n\nExamples:\n  moleman run --prompt \"Fix the lint errors\"\n  moleman run --prompt \"Fix CI\" fix-ci\n  moleman run --config ./moleman.yaml --prompt-file ./prompt.md\n  moleman run --replay latest --prompt \"Fix the lint errors\"\n  moleman run --var target=./pkg --var maxIters=5 --prompt \"Tidy up\"",
 		Flags: []cli.Flag{
 			&cli.StringFlag{Name: "prompt", Usage: "prompt text"},
 			&cli.StringFlag{Name: "prompt-file", Usage: "prompt file path"},
@@ -52,6 +64,12 @@ func runCommand() *cli.Command {
 			&cli.StringFlag{Name: "config", Usage: "config file path"},
 			&cli.BoolFlag{Name: "dry-run", Usage: "resolve and plan without executing"},
 			&cli.BoolFlag{Name: "verbose", Usage: "verbose logging"},
+			&cli.StringFlag{Name: "events", Usage: "also write the JSON Lines event stream to a path or fd:N"},
+			&cli.BoolFlag{Name: "tui", Usage: "show live run progress in a terminal UI"},
+			&cli.StringFlag{Name: "replay", Usage: "replay agent output from a previous run (id, prefix, or latest)"},
+			&cli.StringSliceFlag{Name: "var", Usage: "set a workflow param (key=value, repeatable)"},
+			&cli.StringFlag{Name: "vars-file", Usage: "YAML or JSON file of workflow param values"},
+			&cli.StringFlag{Name: "profile", Usage: "apply a profile from the config's profiles", EnvVars: []string{"MOLEMAN_PROFILE"}},
 		},
 		Action: func(c *cli.Context) error {
 			if c.Bool("verbose") {
@@ -59,7 +77,7 @@ func runCommand() *cli.Command {
 			}
 
 			cfgPath := resolveConfigPath(c.String("config"), c.String("workdir"))
-			cfg, err := moleman.LoadConfig(cfgPath)
+			cfg, err := loadConfigFromFlags(c, cfgPath)
 			if err != nil {
 				return err
 			}
@@ -70,9 +88,12 @@ func runCommand() *cli.Command {
 				Workdir:    c.String("workdir"),
 				DryRun:     c.Bool("dry-run"),
 				Verbose:    c.Bool("verbose"),
+				Version:    Version,
+				Events:     c.String("events"),
+				Replay:     c.String("replay"),
 			}
 
-			result, err := moleman.Run(cfg, cfgPath, runOpts)
+			result, err := runWorkflow(cfg, cfgPath, runOpts, c.Bool("tui"))
 			if err != nil {
 				if result != nil && result.RunDir != "" {
 					log.Warn("run artifacts", "path", result.RunDir)
@@ -86,6 +107,58 @@ func runCommand() *cli.Command {
 	}
 }
 
+// loadConfigFromFlags loads the config with the command's --var and
+// --vars-file param values, --profile, and the workflow named by the first
+// argument.
+func loadConfigFromFlags(c *cli.Context, cfgPath string) (*moleman.Config, error) {
+	if c.NArg() > 1 {
+		return nil, fmt.Errorf("expected at most one workflow name, got %d arguments (flags go before the workflow name)", c.NArg())
+	}
+	vars, err := moleman.ParseVars(c.StringSlice("var"), c.String("vars-file"))
+	if err != nil {
+		return nil, err
+	}
+	return moleman.LoadConfigWithOptions(cfgPath, moleman.LoadOptions{Vars: vars, Profile: c.String("profile"), Workflow: c.Args().First(), Workdir: agentsWorkdir(c)})
+}
+
+// agentsWorkdir is where the repo root agents.yaml is searched from:
+// --workdir, or the current directory so a config under ~/.moleman/configs
+// still picks up the repository's agents.
+func agentsWorkdir(c *cli.Context) string {
+	if workdir := c.String("workdir"); workdir != "" {
+		return workdir
+	}
+	workdir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return workdir
+}
+
+// runWorkflow runs the workflow, optionally under the TUI. While the TUI owns
+// the screen, logs go to its log pane and output.stdout is held back until it
+// exits.
+func runWorkflow(cfg *moleman.Config, cfgPath string, opts moleman.RunOptions, useTUI bool) (*moleman.RunResult, error) {
+	if !useTUI {
+		return moleman.Run(cfg, cfgPath, opts)
+	}
+	tui, err := moleman.NewTUI(cfg, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	opts.OnEvent = tui.Handle
+	opts.Stdout = &stdout
+	opts.Stderr = io.Discard
+	log.SetOutput(tui.LogWriter())
+	tui.Start()
+	result, err := moleman.Run(cfg, cfgPath, opts)
+	tui.Stop()
+	log.SetOutput(os.Stderr)
+	_, _ = os.Stdout.Write(stdout.Bytes())
+	return result, err
+}
+
 func pipelinesCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "agents",
@@ -98,7 +171,7 @@ func pipelinesCommand() *cli.Command {
 		},
 		Action: func(c *cli.Context) error {
 			cfgPath := resolveConfigPath(c.String("config"), c.String("workdir"))
-			cfg, err := moleman.LoadConfig(cfgPath)
+			cfg, err := moleman.LoadConfigWithOptions(cfgPath, moleman.LoadOptions{Workdir: agentsWorkdir(c)})
 			if err != nil {
 				return err
 			}
@@ -115,19 +188,39 @@ func explainCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "explain",
 		Usage:     "Print the resolved workflow",
-		UsageText: "moleman explain [flags]",
+		UsageText: "moleman explain [flags] [workflow]\n\nExamples:\n  moleman explain --format tree\n  moleman explain --format tree review-only\n  moleman explain --workflows\n  moleman explain --format mermaid > workflow.mmd\n  moleman explain --format dot | dot -Tsvg > workflow.svg\n  moleman explain --agents",
 		Flags: []cli.Flag{
 			&cli.StringFlag{Name: "config", Usage: "config file path"},
 			&cli.StringFlag{Name: "workdir", Usage: "working directory"},
+			&cli.StringFlag{Name: "format", Value: "json", Usage: "output format: json, tree, mermaid or dot"},
+			&cli.BoolFlag{Name: "agents", Usage: "show resolved agents, where each field came from, and per-node argv"},
+			&cli.BoolFlag{Name: "workflows", Usage: "list the config's workflows"},
+			&cli.StringSliceFlag{Name: "var", Usage: "set a workflow param (key=value, repeatable)"},
+			&cli.StringFlag{Name: "vars-file", Usage: "YAML or JSON file of workflow param values"},
+			&cli.StringFlag{Name: "profile", Usage: "apply a profile from the config's profiles", EnvVars: []string{"MOLEMAN_PROFILE"}},
 		},
 		Action: func(c *cli.Context) error {
 			cfgPath := resolveConfigPath(c.String("config"), c.String("workdir"))
-			cfg, err := moleman.LoadConfig(cfgPath)
+			cfg, err := loadConfigFromFlags(c, cfgPath)
 			if err != nil {
 				return err
 			}
 
-			return moleman.PrintWorkflow(cfg.Workflow)
+			if c.Bool("workflows") {
+				format := "text"
+				if c.IsSet("format") {
+					format = c.String("format")
+				}
+				return moleman.PrintWorkflows(os.Stdout, cfg, format)
+			}
+			if c.Bool("agents") {
+				format := "text"
+				if c.IsSet("format") {
+					format = c.String("format")
+				}
+				return moleman.PrintAgents(os.Stdout, cfg, format)
+			}
+			return moleman.PrintWorkflowGraph(os.Stdout, cfg, c.String("format"))
 		},
 	}
 }
@@ -136,15 +229,37 @@ func initCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "init",
 		Usage:     "Create an example config",
-		UsageText: "moleman init [flags]",
+		UsageText: "moleman init [flags]\n\nExamples:\n  moleman init --template write-review-loop\n  moleman init --template write-review-loop --agent reviewer=codex\n  moleman init --interactive\n  moleman init --list-templates",
 		Flags: []cli.Flag{
 			&cli.StringFlag{Name: "workdir", Usage: "working directory"},
 			&cli.BoolFlag{Name: "force", Usage: "overwrite existing config"},
 			&cli.StringFlag{Name: "config", Usage: "config file path"},
+			&cli.StringFlag{Name: "template", Aliases: []string{"t"}, Usage: "workflow template (see --list-templates)"},
+			&cli.StringSliceFlag{Name: "agent", Usage: "agent for a template role, as role=agent (repeatable)"},
+			&cli.BoolFlag{Name: "interactive", Aliases: []string{"i"}, Usage: "pick the template and agents, defaulting to agent CLIs found on PATH"},
+			&cli.BoolFlag{Name: "list-templates", Usage: "list templates and exit"},
+			&cli.StringFlag{Name: "format", Value: "text", Usage: "list-templates format: text or json"},
 		},
 		Action: func(c *cli.Context) error {
+			if c.Bool("list-templates") {
+				return moleman.PrintInitTemplates(os.Stdout, c.String("format"))
+			}
 			cfgPath := resolveConfigPath(c.String("config"), c.String("workdir"))
-			if err := moleman.Init(cfgPath, c.Bool("force")); err != nil {
+			opts := moleman.InitOptions{Template: c.String("template"), Agents: map[string]string{}, Force: c.Bool("force")}
+			for _, pair := range c.StringSlice("agent") {
+				role, agent, ok := strings.Cut(pair, "=")
+				if !ok || role == "" || agent == "" {
+					return fmt.Errorf("invalid --agent %q (want role=agent)", pair)
+				}
+				opts.Agents[role] = agent
+			}
+			write := moleman.Init
+			if c.Bool("interactive") {
+				write = func(path string, opts moleman.InitOptions) error {
+					return moleman.InitInteractive(path, opts, os.Stdin, os.Stderr)
+				}
+			}
+			if err := write(cfgPath, opts); err != nil {
 				return err
 			}
 			log.Info("created", "path", cfgPath)
@@ -157,22 +272,231 @@ func doctorCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "doctor",
 		Usage:     "Validate environment and config",
-		UsageText: "moleman doctor [flags]",
+		UsageText: "moleman doctor [flags] [workflow]",
 		Flags: []cli.Flag{
 			&cli.StringFlag{Name: "workdir", Usage: "working directory"},
 			&cli.StringFlag{Name: "config", Usage: "config file path"},
+			&cli.BoolFlag{Name: "json", Usage: "print the report as JSON"},
+			&cli.StringSliceFlag{Name: "var", Usage: "set a workflow param (key=value, repeatable)"},
+			&cli.StringFlag{Name: "vars-file", Usage: "YAML or JSON file of workflow param values"},
+			&cli.StringFlag{Name: "profile", Usage: "apply a profile from the config's profiles", EnvVars: []string{"MOLEMAN_PROFILE"}},
 		},
 		Action: func(c *cli.Context) error {
+			if c.NArg() > 1 {
+				return fmt.Errorf("expected at most one workflow name, got %d arguments (flags go before the workflow name)", c.NArg())
+			}
+			vars, err := moleman.ParseVars(c.StringSlice("var"), c.String("vars-file"))
+			if err != nil {
+				return err
+			}
 			cfgPath := resolveConfigPath(c.String("config"), c.String("workdir"))
-			if err := moleman.Doctor(cfgPath); err != nil {
+			report := moleman.RunDoctor(cfgPath, c.String("workdir"), moleman.LoadOptions{Vars: vars, Profile: c.String("profile"), Workflow: c.Args().First(), Workdir: agentsWorkdir(c)})
+			format := "text"
+			if c.Bool("json") {
+				format = "json"
+			}
+			if err := moleman.PrintDoctorReport(os.Stdout, report, format); err != nil {
 				return err
 			}
-			log.Info("doctor ok")
+			if err := report.Err(); err != nil {
+				return err
+			}
+			if !c.Bool("json") {
+				log.Info("doctor ok")
+			}
 			return nil
 		},
 	}
 }
 
+func testCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "test",
+		Usage:     "Run workflow tests against mocked agents",
+		UsageText: "moleman test [flags] [paths...]\n\nPaths are *.moleman-test.yaml files or directories to search (default: .).",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "verbose", Usage: "show run logs"},
+		},
+		Action: func(c *cli.Context) error {
+			if !c.Bool("verbose") {
+				log.SetLevel(log.WarnLevel)
+			}
+			files, err := moleman.FindWorkflowTests(c.Args().Slice())
+			if err != nil {
+				return err
+			}
+			if len(files) == 0 {
+				return fmt.Errorf("no *.moleman-test.yaml files found")
+			}
+			passed, failed := 0, 0
+			for _, file := range files {
+				results, err := moleman.RunWorkflowTests(file)
+				if err != nil {
+					fmt.Printf("FAIL %s\n    %v\n", file, err)
+					failed++
+					continue
+				}
+				for _, result := range results {
+					if result.Passed() {
+						fmt.Printf("ok   %s: %s (%s)\n", result.File, result.Name, result.Duration.Round(time.Millisecond))
+						passed++
+						continue
+					}
+					fmt.Printf("FAIL %s: %s (%s)\n", result.File, result.Name, result.Duration.Round(time.Millisecond))
+					for _, failure := range result.Failures {
+						fmt.Printf("    %s\n", failure)
+					}
+					failed++
+				}
+			}
+			fmt.Printf("%d passed, %d failed\n", passed, failed)
+			if failed > 0 {
+				return fmt.Errorf("%d workflow test(s) failed", failed)
+			}
+			return nil
+		},
+	}
+}
+
+func schemaCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "schema",
+		Usage:     "Print the JSON Schema for moleman.yaml or agents.yaml",
+		UsageText: "moleman schema [config|agents]\n\nExamples:\n  moleman schema > moleman.schema.json\n  moleman schema agents > agents.schema.json",
+		Action: func(c *cli.Context) error {
+			if c.NArg() > 1 {
+				return fmt.Errorf("schema takes at most one argument")
+			}
+			return moleman.PrintSchema(os.Stdout, c.Args().First())
+		},
+	}
+}
+
+func migrateCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "migrate",
+		Usage:     "Rewrite a version 1 config as version 2, keeping comments",
+		UsageText: "moleman migrate [flags]\n\nExamples:\n  moleman migrate > moleman.v2.yaml\n  moleman migrate --write --config ./moleman.yaml",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "config", Usage: "config file path"},
+			&cli.StringFlag{Name: "workdir", Usage: "working directory"},
+			&cli.BoolFlag{Name: "write", Aliases: []string{"w"}, Usage: "replace the config file instead of printing the result"},
+		},
+		Action: func(c *cli.Context) error {
+			cfgPath := resolveConfigPath(c.String("config"), c.String("workdir"))
+			migrated, err := moleman.MigrateConfigFile(cfgPath, c.Bool("write"))
+			if err != nil {
+				return err
+			}
+			if c.Bool("write") {
+				log.Info("migrated", "path", cfgPath, "version", 2)
+				return nil
+			}
+			_, err = os.Stdout.Write(migrated)
+			return err
+		},
+	}
+}
+
+func runsCommand() *cli.Command {
+	flags := []cli.Flag{
+		&cli.StringFlag{Name: "config", Usage: "config file path"},
+		&cli.StringFlag{Name: "workdir", Usage: "working directory"},
+	}
+	return &cli.Command{
+		Name:      "runs",
+		Usage:     "List, inspect and prune past runs",
+		UsageText: "moleman runs <list|show|open|prune> [flags]",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "list",
+				Usage:     "List past runs, newest first",
+				UsageText: "moleman runs list [flags]",
+				Flags:     flags,
+				Action: func(c *cli.Context) error {
+					runs, err := moleman.ListRuns(resolveRunsDir(c))
+					if err != nil {
+						return err
+					}
+					return moleman.PrintRuns(os.Stdout, runs)
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "Print a run summary and the tail of each node's logs",
+				UsageText: "moleman runs show [flags] <id|latest>",
+				Flags:     flags,
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("usage: moleman runs show <id|latest>")
+					}
+					run, err := moleman.ResolveRun(resolveRunsDir(c), c.Args().First())
+					if err != nil {
+						return err
+					}
+					return moleman.ShowRun(os.Stdout, run)
+				},
+			},
+			{
+				Name:      "open",
+				Usage:     "Print a node's stdout or stderr",
+				UsageText: "moleman runs open [--stderr] [--iteration N] <id|latest> <node>",
+				Flags: append([]cli.Flag{
+					&cli.BoolFlag{Name: "stderr", Usage: "print stderr instead of stdout"},
+					&cli.StringFlag{Name: "iteration", Usage: "loop iteration (e.g. 2 or 2-1); defaults to the latest"},
+				}, flags...),
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 2 {
+						return fmt.Errorf("usage: moleman runs open <id|latest> <node>")
+					}
+					run, err := moleman.ResolveRun(resolveRunsDir(c), c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					stream := "stdout"
+					if c.Bool("stderr") {
+						stream = "stderr"
+					}
+					return moleman.OpenRunNode(os.Stdout, run, c.Args().Get(1), stream, c.String("iteration"))
+				},
+			},
+			{
+				Name:      "prune",
+				Usage:     "Delete old runs",
+				UsageText: "moleman runs prune [--keep N] [--older-than 7d] [--dry-run]",
+				Flags: append([]cli.Flag{
+					&cli.IntFlag{Name: "keep", Usage: "keep the N most recent runs"},
+					&cli.StringFlag{Name: "older-than", Usage: "only delete runs older than this age (e.g. 7d, 12h)"},
+					&cli.BoolFlag{Name: "dry-run", Usage: "list runs that would be deleted"},
+				}, flags...),
+				Action: func(c *cli.Context) error {
+					olderThan, err := moleman.ParseAge(c.String("older-than"))
+					if err != nil {
+						return err
+					}
+					removed, err := moleman.PruneRuns(resolveRunsDir(c), moleman.PruneOptions{
+						Keep:      c.Int("keep"),
+						OlderThan: olderThan,
+						DryRun:    c.Bool("dry-run"),
+					}, time.Now())
+					for _, run := range removed {
+						if c.Bool("dry-run") {
+							fmt.Println("would remove", run.ID)
+						} else {
+							fmt.Println("removed", run.ID)
+						}
+					}
+					if err != nil {
+						return err
+					}
+					log.Info("prune done", "runs", len(removed))
+					return nil
+				},
+			},
+		},
+	}
+}
+
 func versionCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "version",
@@ -219,6 +543,14 @@ func resolveConfigPath(configPath, workdir string) string {
 	return primary
 }
 
+func resolveRunsDir(c *cli.Context) string {
+	workdir := c.String("workdir")
+	if workdir == "" {
+		workdir = moleman.ConfigDir(resolveConfigPath(c.String("config"), ""))
+	}
+	return moleman.RunsDir(workdir)
+}
+
 func fileExists(path string) bool {
 	info, err := os.Stat(path)
 	if err != nil {